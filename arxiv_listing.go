@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const arxivRssUrl = "https://rss.arxiv.org/rss/"
+
+// ArxivListing reads the daily announcements of arXiv categories from their
+// RSS feeds, which hold the submissions of the latest announcement and are
+// empty on days arXiv does not announce (weekends and holidays).
+type ArxivListing struct {
+	// Url defaults to arXiv's RSS service; the category is appended.
+	Url string
+}
+
+// Announcement is the list of submissions announced in a category on a day.
+type Announcement struct {
+	Category string
+	Date     time.Time
+	Papers   []Paper
+}
+
+type arxivRss struct {
+	Channel struct {
+		PubDate string `xml:"pubDate"`
+		Items   []struct {
+			Title        string   `xml:"title"`
+			Link         string   `xml:"link"`
+			Description  string   `xml:"description"`
+			Categories   []string `xml:"category"`
+			Creator      string   `xml:"creator"`
+			AnnounceType string   `xml:"announce_type"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+// Fetch returns the latest announcement in category. Replacements of
+// earlier submissions are left out; cross-lists from other categories are
+// kept.
+func (l *ArxivListing) Fetch(category string) (*Announcement, error) {
+	rawurl := l.Url
+	if rawurl == "" {
+		rawurl = arxivRssUrl
+	}
+	req, err := http.NewRequest("GET", rawurl+category, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "paperbot (+https://github.com/reiyw/paperbot)")
+	res, err := trendClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("status code error: %d %s", res.StatusCode, res.Status)
+	}
+
+	var rss arxivRss
+	if err = xml.NewDecoder(res.Body).Decode(&rss); err != nil {
+		return nil, err
+	}
+
+	announcement := &Announcement{Category: category}
+	announcement.Date, err = time.Parse(time.RFC1123Z, rss.Channel.PubDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pubDate of %s: %q", category, rss.Channel.PubDate)
+	}
+	for _, item := range rss.Channel.Items {
+		if item.AnnounceType != "new" && item.AnnounceType != "cross" {
+			continue
+		}
+		var paper Paper
+		paper.Id = arxivVersion.ReplaceAllString(arxivIdFromUrl(item.Link), "")
+		paper.Title = strings.TrimSpace(item.Title)
+		for _, author := range strings.Split(item.Creator, ",") {
+			if author = strings.TrimSpace(author); author != "" {
+				paper.Authors = append(paper.Authors, author)
+			}
+		}
+		paper.Year = announcement.Date.Year()
+		paper.AbstUrl = fmt.Sprintf("https://arxiv.org/abs/%s", paper.Id)
+		paper.PdfUrl = fmt.Sprintf("https://arxiv.org/pdf/%s.pdf", paper.Id)
+		paper.HtmlUrl = fmt.Sprintf("https://www.arxiv-vanity.com/papers/%s/", paper.Id)
+		// "arXiv:2410.05258v1 Announce Type: new \nAbstract: ..."
+		if i := strings.Index(item.Description, "Abstract:"); i >= 0 {
+			paper.AbstText = strings.TrimSpace(strings.Replace(item.Description[i+len("Abstract:"):], "\n", " ", -1))
+		}
+		paper.Categories = item.Categories
+		paper.Preserver = Arxiv
+		announcement.Papers = append(announcement.Papers, paper)
+	}
+	return announcement, nil
+}
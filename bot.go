@@ -1,179 +1,567 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"github.com/abadojack/whatlanggo"
-	"github.com/carlescere/scheduler"
-	"github.com/joho/godotenv"
 	"github.com/nlopes/slack"
-	"github.com/reiyw/paperbot/queue"
+	"github.com/reiyw/paperbot/logging"
 	"github.com/reiyw/paperbot/translate"
 	"log"
 	"mvdan.cc/xurls"
+	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
 func main() {
-	err := godotenv.Load()
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(configCommand(os.Args[2:]))
+	}
+
+	config, err := loadConfig()
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		log.Fatal(err)
 	}
+	logConfig, _ := config.Log.logging()
+	logging.Configure(os.Stdout, logConfig)
 
-	api := slack.New(os.Getenv("PAPERBOT_SLACK_TOKEN"))
-	arxivTrendChannelId := os.Getenv("ARXIV_TREND_CHANNEL_ID")
-	botUserId := os.Getenv("BOT_USER_ID")
-	botUserName := os.Getenv("BOT_USER_NAME")
-	botIconUrl := os.Getenv("BOT_ICON_URL")
+	// SIGINT and SIGTERM stop the bot gracefully
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	supervisor := NewSupervisor(ctx)
 
-	channelQueue := queue.New()
+	api := slack.New(config.Slack.Token)
+	arxivTrendChannelId := config.Slack.TrendChannelId
+	botUserId := config.Slack.BotUserId
+	botUserName := config.Slack.BotUserName
+	botIconUrl := config.Slack.BotIconUrl
 
-	rtm := api.NewRTM()
-	go rtm.ManageConnection()
+	// the configuration is valid, so parsing it again cannot fail
+	translate.DefaultCache = translate.NewCache(1024, config.Translate.CacheTTL.Duration, config.Translate.CacheDir)
+	var translateProxy *url.URL
+	if config.Translate.Proxy != "" {
+		translateProxy, _ = url.Parse(config.Translate.Proxy)
+	}
+	translate.DefaultClient = translate.NewClient(config.Translate.Timeout.Duration, translateProxy)
 
-	requestAndSendTrendingPapers := func() {
-		var papers []Paper
-		trendingPapers := RequestTrendingPapersOnArxiv()
-		for _, tp := range trendingPapers {
-			p, err := FromArxivId(tp.Id)
-			if err != nil {
-				continue
-			}
-			papers = append(papers, *p)
-		}
-		for i, p := range papers {
-			info := fmt.Sprintf("[%d tweets] %s", trendingPapers[i].TweetCount, formatAsPlainPaperInfo(p))
-			rtm.SendMessage(rtm.NewOutgoingMessage(info, arxivTrendChannelId))
-			channelQueue.PushBack(arxivTrendChannelId)
-		}
+	store, err := NewStore(config.Storage.DataDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	languagePairs, _ := ParseLanguagePairs(config.Translate.Pairs)
+	defaultLanguage, _ := normalizeLanguage(config.Translate.DefaultLang)
+	languages, err := NewLanguages(store, languagePairs, defaultLanguage)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	detector := translate.NewChainDetector(config.Translate.DetectThreshold, "auto")
+
+	alignAbstracts := config.Translate.AlignAbstracts
+
+	channelSettings, err := NewChannelSettings(store, config.Trend.Layout, config.Trend.Mode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	trendHistory, err := NewTrendHistory(store)
+	if err != nil {
+		log.Fatal(err)
 	}
-	_, err = scheduler.Every().Day().At("12:00").Run(requestAndSendTrendingPapers)
+	userSubscriptions, err := NewUserSubscriptions(store)
 	if err != nil {
-		fmt.Printf("Scheduler error: %s\n", err)
+		log.Fatal(err)
 	}
+	userSubscriptions.Conversations = NewConversations(func(channel string) (*slack.Channel, error) {
+		return api.GetConversationInfo(channel, false)
+	})
 
-	for msg := range rtm.IncomingEvents {
-		fmt.Print("Event Received: ")
-		switch ev := msg.Data.(type) {
-		case *slack.ConnectedEvent:
-			fmt.Println("Infos:", ev.Info)
-			fmt.Println("Connection counter:", ev.ConnectionCount)
+	fetchIntervals, _ := ParseHostIntervals(config.Fetch.HostIntervals)
+	paperCache, err := NewPaperCache(store, config.Fetch.CacheTTL.Duration, config.Fetch.CacheNegativeTTL.Duration)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fetchPool := NewFetchPool(config.Fetch.Workers, fetchIntervals, paperCache.Request)
 
-		case *slack.MessageEvent:
-			fmt.Printf("Message: %v\n", ev)
+	// settings that are cheap to change are applied again on SIGHUP
+	supervisor.Go("reload", func(ctx context.Context) error {
+		reloadOnHangup(ctx, config, func(next *Config) {
+			logConfig, _ := next.Log.logging()
+			logging.Configure(os.Stdout, logConfig)
+			intervals, _ := ParseHostIntervals(next.Fetch.HostIntervals)
+			fetchPool.SetIntervals(intervals)
+			paperCache.SetTTL(next.Fetch.CacheTTL.Duration, next.Fetch.CacheNegativeTTL.Duration)
+		})
+		return nil
+	})
 
-			if ev.Text == "trend" {
-				fmt.Println("trend")
-				requestAndSendTrendingPapers()
-				continue
+	// events are passed on from the current connection to Slack
+	events := make(chan slack.RTMEvent)
+	supervisor.Go("slack", func(ctx context.Context) error {
+		// a connection that gave up cannot be managed again, so every run
+		// opens its own
+		rtm := api.NewRTM()
+		closed := make(chan struct{})
+		go func() {
+			rtm.ManageConnection()
+			close(closed)
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				_ = rtm.Disconnect()
+				return nil
+			case msg := <-rtm.IncomingEvents:
+				select {
+				case <-ctx.Done():
+				case events <- msg:
+				}
+			case <-closed:
+				// the events sent before it gave up, such as invalid
+				// credentials, are passed on first
+				for {
+					select {
+					case msg := <-rtm.IncomingEvents:
+						select {
+						case <-ctx.Done():
+							return nil
+						case events <- msg:
+						}
+					default:
+						return fmt.Errorf("connection closed")
+					}
+				}
 			}
+		}
+	})
 
-			urls := xurls.Relaxed().FindAllString(ev.Text, -1)
-			var papers []Paper
-			for _, url := range urls {
-				p, err := Request(url)
-				if err != nil {
-					fmt.Printf("Request error: %s\n", err)
+	// messages are posted through the outbox, so that they are rate limited
+	// and retried, and survive a restart
+	outbox, err := NewOutbox(store, func(m OutboxMessage) (string, error) {
+		params := slack.PostMessageParameters{AsUser: true}
+		if m.ThreadTimestamp != "" {
+			params = slack.PostMessageParameters{
+				Attachments:     m.Attachments,
+				ThreadTimestamp: m.ThreadTimestamp,
+				IconURL:         botIconUrl,
+				Username:        botUserName,
+			}
+		}
+		_, timestamp, err := api.PostMessage(m.Channel, m.Text, params)
+		if err != nil {
+			slackAPIErrors.Inc("chat.postMessage")
+		}
+		return timestamp, err
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	registerOutboxMetrics(outbox)
+	// the details of the papers a message links are posted in its thread
+	outbox.OnSent = func(m OutboxMessage, timestamp string) {
+		if !m.Details {
+			return
+		}
+		supervisor.Task("details", func() {
+			urls := xurls.Relaxed().FindAllString(m.Text, -1)
+			fetchLog.Debug("found URLs", "channel", m.Channel, "urls", urls)
+			for _, r := range fetchPool.FetchAll(urls) {
+				if r.Err != nil {
 					continue
 				}
-				papers = append(papers, *p)
+				outbox.Enqueue(OutboxMessage{
+					Channel:         m.Channel,
+					ThreadTimestamp: timestamp,
+					Attachments:     []slack.Attachment{formatAsAttachment(*r.Paper, languages.ChannelLanguages(m.Channel), alignAbstracts)},
+					Reply:           m.Reply,
+				})
 			}
-			if len(papers) > 0 {
-				for _, p := range papers {
-					rtm.SendMessage(rtm.NewOutgoingMessage(formatAsPlainPaperInfo(p), ev.Channel))
-					channelQueue.PushBack(ev.Channel)
-				}
-				continue
+		})
+	}
+	supervisor.Go("outbox", func(ctx context.Context) error {
+		outbox.Run(ctx)
+		return nil
+	})
+	sendWithDetails := outbox.SendWithDetails
+	send := outbox.Send
+	// answers to users go ahead of digests and alerts
+	reply := outbox.Reply
+
+	trendSource, _ := parseTrendSources(config.Trend.Source, config.Trend.FeedUrl)
+	trending := &trendPoster{
+		Source:         trendSource,
+		Limit:          config.Trend.Limit,
+		Settings:       channelSettings,
+		History:        trendHistory,
+		DefaultChannel: arxivTrendChannelId,
+		Send:           sendWithDetails,
+		Subscribers:    userSubscriptions,
+		Pool:           fetchPool,
+	}
+
+	// alerts list many papers, so their details are not posted
+	newSubmissions, err := newNewSubmissionPoster(&ArxivListing{}, channelSettings, store, send)
+	if err != nil {
+		log.Fatal(err)
+	}
+	newSubmissions.Subscribers = userSubscriptions
+
+	// papers matching personal subscriptions are sent as one direct
+	// message per user each time the notifications job runs
+	notifySubscribers := func() {
+		userSubscriptions.Flush(func(user, text string) error {
+			_, _, channel, err := api.OpenIMChannel(user)
+			if err != nil {
+				slackAPIErrors.Inc("im.open")
+				return err
 			}
+			send(channel, text)
+			return nil
+		})
+	}
 
+	scheduleLocation, _ := config.Schedule.Location()
+	holidays, _ := ParseHolidays(config.Schedule.Holidays)
+	scheduler, err := NewScheduler(store)
+	if err != nil {
+		log.Fatal(err)
+	}
+	runs := map[string]func(){
+		"trending":        trending.PostAll,
+		"new submissions": newSubmissions.PostAll,
+		"weekly digest":   trending.PostWeekly,
+		"notifications":   notifySubscribers,
+	}
+	for _, job := range config.Schedule.jobs() {
+		if job.expr == "off" {
+			continue
+		}
+		schedule, _ := ParseSchedule(job.expr, scheduleLocation)
+		schedule.SkipWeekends = config.Schedule.SkipWeekends
+		schedule.Holidays = holidays
+		scheduler.Add(job.name, schedule, runs[job.name])
+	}
+	supervisor.Go("scheduler", scheduler.Run)
 
-			// if direct message or mention, do translate
-			if strings.HasPrefix(ev.Channel, "D") || strings.Contains(ev.Text, botUserId) {
-				text := strings.Replace(ev.Text, fmt.Sprintf("<@%s>", botUserId), "", 1)
-				lang := whatlanggo.DetectLang(text)
-				var langFrom string
-				var langTo string
-				switch lang {
-				case whatlanggo.Jpn:
-					langFrom = "ja"
-					langTo = "en"
-				case whatlanggo.Eng:
-					langFrom = "en"
-					langTo = "ja"
-				default:
-					langFrom = "auto"
-					langTo = "ja"
-				}
-				rtm.SendMessage(rtm.NewOutgoingMessage(translate.Google(langFrom, langTo, text), ev.Channel))
+	// the bot is ready once connected to Slack and able to keep its state
+	var connection connectionState
+	health := NewHealth()
+	health.AddCheck("slack", connection.Check)
+	health.AddCheck("store", store.Check)
+	if config.HTTP.Addr != "off" {
+		supervisor.Go("http", func(ctx context.Context) error {
+			server := &http.Server{Addr: config.HTTP.Addr, Handler: health.Handler()}
+			defer onDone(ctx, func() { _ = server.Close() })()
+			if err := server.ListenAndServe(); err != http.ErrServerClosed {
+				return err
 			}
+			return nil
+		})
+	}
 
-		case *slack.PresenceChangeEvent:
-			fmt.Printf("Presence Change: %v\n", ev)
+	var authFailed int32
+	supervisor.Go("events", func(ctx context.Context) error {
+		for {
+			var msg slack.RTMEvent
+			select {
+			case <-ctx.Done():
+				return nil
+			case msg = <-events:
+			}
 
-		case *slack.LatencyReport:
-			fmt.Printf("Current latency: %v\n", ev.Value)
+			switch ev := msg.Data.(type) {
+			case *slack.ConnectedEvent:
+				slackLog.Info("connected", "connections", ev.ConnectionCount)
+				connection.Set(true, time.Now())
+				if ev.ConnectionCount > 1 {
+					slackReconnects.Inc()
+				}
 
-		case *slack.RTMError:
-			fmt.Printf("Error: %s\n", ev.Error())
+			case *slack.DisconnectedEvent:
+				slackLog.Warn("disconnected", "intentional", ev.Intentional)
+				connection.Set(false, time.Now())
 
-		case *slack.InvalidAuthEvent:
-			fmt.Printf("Invalid credentials")
-			return
+			case *slack.ConnectionErrorEvent:
+				slackLog.Warn("connection error", "attempt", ev.Attempt, "error", ev.Error())
+				slackAPIErrors.Inc("rtm.connect")
 
-		case *slack.AckMessage:
-			fmt.Printf("AckMessage: %v\n", ev)
-			urls := xurls.Relaxed().FindAllString(ev.Text, -1)
-			fmt.Println("found URLs: ", urls)
-			var papers []Paper
-			for _, url := range urls {
-				p, err := Request(url)
-				if err != nil {
+			case *slack.MessageEvent:
+				if ignoreMessage(ev, botUserId) {
 					continue
 				}
-				papers = append(papers, *p)
-			}
-			for _, p := range papers {
-				params := slack.PostMessageParameters{
-					Attachments:     []slack.Attachment{formatAsAttachment(p)},
-					ThreadTimestamp: ev.Timestamp,
-					IconURL:         botIconUrl,
-					Username:        botUserName,
+				// the records of a message are tied together by a request ID
+				fields := []interface{}{"request", logging.RequestId(), "channel", ev.Channel, "user", ev.User}
+				eventLog := slackLog.With(fields...)
+				eventLog.Debug("message received", "ts", ev.Timestamp, "subtype", ev.SubType, "text", ev.Text)
+
+				switch name, args := parseCommand(ev.Text, ev.Channel, botUserId); name {
+				case "trend":
+					if len(args) > 0 {
+						reply(ev.Channel, trendCommand(channelSettings, args, ev.Channel))
+						continue
+					}
+					// papers are fetched within the per-host limits, which
+					// takes a while, so the event loop is not held up
+					eventLog.Info("posting trending papers")
+					channel := ev.Channel
+					supervisor.Task("trend", func() { trending.Post(channel) })
+					continue
+				case "lang":
+					reply(ev.Channel, langCommand(languages, args, ev.User, ev.Channel))
+					continue
+				case "arxiv":
+					reply(ev.Channel, arxivCommand(channelSettings, args, ev.Channel))
+					continue
+				case "outbox":
+					if len(args) == 1 && args[0] == "retry" {
+						reply(ev.Channel, fmt.Sprintf("Retrying %d messages.", outbox.RetryDeadLetters()))
+						continue
+					}
+					reply(ev.Channel, formatOutboxStats(outbox.Stats(), outbox.DeadLetters()))
+					continue
+				case "refresh":
+					if len(args) != 1 {
+						reply(ev.Channel, "Usage: refresh <url>")
+						continue
+					}
+					channel, rawurl := ev.Channel, args[0]
+					supervisor.Task("refresh", func() {
+						paper, err := paperCache.Refresh(strings.Split(strings.Trim(rawurl, "<>"), "|")[0])
+						if err != nil {
+							reply(channel, fmt.Sprintf("Could not refresh %s: %s", rawurl, err))
+							return
+						}
+						outbox.Enqueue(OutboxMessage{Channel: channel, Text: formatAsPlainPaperInfo(*paper), Details: true, Reply: true})
+					})
+					continue
+				case "schedule":
+					reply(ev.Channel, formatJobRuns(scheduler.Runs(time.Now()), scheduleLocation))
+					continue
+				case "subscribe", "unsubscribe":
+					reply(ev.Channel, subscribeCommand(userSubscriptions, name, args, ev.User))
+					continue
 				}
-				channel := fmt.Sprintf("%s", channelQueue.PopFront())
-				_, _, _ = rtm.PostMessage(channel, "", params)
+
+				// papers are fetched in the background so that the event loop
+				// is not held up, and posted in the order they were shared
+				urls := xurls.Relaxed().FindAllString(ev.Text, -1)
+				requestLog := fetchLog.With(fields...)
+				fetchPool.Submit(ev.Channel, urls, func(results []FetchResult) {
+					var papers []Paper
+					for _, r := range results {
+						if r.Err != nil {
+							requestLog.Warn("request error", "url", r.Url, "error", r.Err)
+							continue
+						}
+						papers = append(papers, *r.Paper)
+					}
+					if len(papers) > 0 {
+						for _, p := range papers {
+							outbox.Enqueue(OutboxMessage{Channel: ev.Channel, Text: formatAsPlainPaperInfo(p), Details: true, Reply: true})
+						}
+						userSubscriptions.MatchShared(ev.Channel, papers, ev.User)
+						return
+					}
+
+					// if direct message or mention, do translate
+					if strings.HasPrefix(ev.Channel, "D") || strings.Contains(ev.Text, botUserId) {
+						text := strings.Replace(ev.Text, fmt.Sprintf("<@%s>", botUserId), "", 1)
+						langFrom := detector.Detect(text).Lang
+						langTo := languages.Target(langFrom, ev.User, ev.Channel)
+						reply(ev.Channel, translate.Google(langFrom, langTo, text))
+					}
+				})
+
+			case *slack.PresenceChangeEvent:
+				slackLog.Debug("presence change", "user", ev.User, "presence", ev.Presence)
+
+			case *slack.LatencyReport:
+				slackLog.Debug("latency", "value", ev.Value)
+
+			case *slack.RTMError:
+				slackLog.Error("RTM error", "error", ev.Error())
+				slackAPIErrors.Inc("rtm")
+
+			case *slack.InvalidAuthEvent:
+				slackLog.Error("invalid credentials")
+				atomic.StoreInt32(&authFailed, 1)
+				stop()
+				return nil
+
+			case *slack.AckMessage:
+				slackLog.Debug("ack", "reply_to", ev.ReplyTo, "ts", ev.Timestamp)
+
+			default:
+				slackLog.Debug("unexpected event", "type", msg.Type)
 			}
+		}
+	})
+
+	<-ctx.Done()
+	lifecycleLog.Info("shutting down", "timeout", config.Shutdown.Timeout.Duration)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.Shutdown.Timeout.Duration)
+	if !supervisor.Wait(shutdownCtx) || !fetchPool.Wait(shutdownCtx) {
+		lifecycleLog.Warn("gave up waiting for work in flight")
+	}
+	// the details of the papers posted while draining are fetched and posted
+	// too
+	left := outbox.Drain(shutdownCtx)
+	if supervisor.Wait(shutdownCtx) {
+		left = outbox.Drain(shutdownCtx)
+	}
+	if left > 0 {
+		lifecycleLog.Warn("messages left to post after a restart", "count", left)
+	}
+	cancel()
+	if err := store.Sync(); err != nil {
+		storeLog.Error("sync failed", "error", err)
+	}
+	lifecycleLog.Info("stopped")
+	if atomic.LoadInt32(&authFailed) == 1 {
+		os.Exit(1)
+	}
+}
+
+// trendEntry is a trending paper together with its metadata.
+type trendEntry struct {
+	Trend  TrendingPaper
+	Paper  Paper
+	Change TrendChange
+}
+
+// formatTrendDigest lists trending papers in one message, numbered by rank.
+func formatTrendDigest(entries []trendEntry) string {
+	var b strings.Builder
+	_, _ = b.WriteString("*Trending papers*")
+	for _, e := range entries {
+		_, _ = fmt.Fprintf(&b, "\n%d. %s", e.Change.Rank, formatTrendEntry(e))
+	}
+	return b.String()
+}
 
-		default:
-			fmt.Printf("Unexpected: %v\n", msg.Data)
+// formatTrendEntry shows a trending paper with why it is trending and how
+// its rank changed, as a line of the digest or a message of its own.
+func formatTrendEntry(e trendEntry) string {
+	return fmt.Sprintf("[%s]%s %s", formatTrendReason(e.Trend), formatTrendChange(e.Change), formatAsPlainPaperInfo(e.Paper))
+}
+
+// weeklyEntry is a paper of the weekly digest together with its metadata.
+type weeklyEntry struct {
+	Trend WeeklyTrend
+	Paper Paper
+}
+
+// formatWeeklyDigest lists the papers trending for the most days of the week.
+func formatWeeklyDigest(entries []weeklyEntry) string {
+	var b strings.Builder
+	_, _ = b.WriteString("*Trending this week*")
+	for i, e := range entries {
+		_, _ = fmt.Fprintf(&b, "\n%d. [%d days, best #%d] %s", i+1, e.Trend.Days, e.Trend.BestRank, formatAsPlainPaperInfo(e.Paper))
+	}
+	return b.String()
+}
+
+// formatTrendChange marks new papers and movers and counts the days a paper
+// has been on the list, e.g. " ↑4 day 3".
+func formatTrendChange(c TrendChange) string {
+	var marks []string
+	switch moved := c.Moved(); {
+	case c.New() && c.Rank > 0:
+		marks = append(marks, ":new:")
+	case moved >= trendMoverThreshold:
+		marks = append(marks, fmt.Sprintf("↑%d", moved))
+	case moved <= -trendMoverThreshold:
+		marks = append(marks, fmt.Sprintf("↓%d", -moved))
+	}
+	if c.Days > 1 {
+		marks = append(marks, fmt.Sprintf("day %d", c.Days))
+	}
+	if len(marks) == 0 {
+		return ""
+	}
+	return " " + strings.Join(marks, " ")
+}
+
+// formatTrendReason links the reason a paper is trending to its discussion
+// thread, if there is one.
+func formatTrendReason(tp TrendingPaper) string {
+	if len(tp.Evidence) > 0 {
+		var reasons []string
+		for _, e := range tp.Evidence {
+			reasons = append(reasons, formatTrendReason(e))
 		}
+		return strings.Join(reasons, ", ")
 	}
+	if tp.DiscussionUrl == "" {
+		return tp.Reason
+	}
+	return fmt.Sprintf("<%s|%s>", tp.DiscussionUrl, tp.Reason)
 }
 
 func formatAsPlainPaperInfo(p Paper) string {
 	return fmt.Sprintf("%s. <%s |%s>. %d", concatAuthors(p.Authors), p.AbstUrl, p.Title, p.Year)
 }
 
-func formatAsAttachment(p Paper) slack.Attachment {
-	abstTextJa := translate.Google("en", "ja", p.AbstText)
+// formatAsAttachment shows the abstract of p followed by its translations into
+// langs. If aligned, each translation is interleaved sentence by sentence with
+// the original instead.
+func formatAsAttachment(p Paper, langs []string, aligned bool) slack.Attachment {
+	var fields []slack.AttachmentField
+	for _, lang := range langs {
+		if lang == "en" {
+			continue
+		}
+		if !aligned {
+			fields = append(fields, slack.AttachmentField{
+				Title: abstractFieldTitle(lang),
+				Value: translate.Google("en", lang, p.AbstText),
+			})
+			continue
+		}
+		// the plain abstract is shown instead if the translation failed
+		if pairs := translate.Aligned("en", lang, p.AbstText); len(pairs) > 0 {
+			fields = append(fields, slack.AttachmentField{
+				Title: fmt.Sprintf("Abstract / %s", abstractFieldTitle(lang)),
+				Value: formatAligned(pairs),
+			})
+		}
+	}
+	if !aligned || len(fields) == 0 {
+		fields = append([]slack.AttachmentField{{
+			Title: "Abstract",
+			Value: p.AbstText,
+		}}, fields...)
+	}
+	// the fields are not formatted as markdown, which would turn the
+	// underscores and asterisks of formulas into italics and bold
 	attachment := slack.Attachment{
 		Color:      p.Preserver.ToColor(),
 		AuthorName: concatAuthors(p.Authors),
 		Title:      p.Title,
 		TitleLink:  p.AbstUrl,
 		Text:       p.Comment,
-		Fields: []slack.AttachmentField{
-			{
-				Title: "Abstract",
-				Value: p.AbstText,
-			}, {
-				Title: "概要",
-				Value: abstTextJa,
-			},
-		},
+		Fields:     fields,
 	}
 	return attachment
 }
 
+// formatAligned renders each sentence with its translation below it.
+func formatAligned(pairs []translate.SentencePair) string {
+	var b strings.Builder
+	for i, pair := range pairs {
+		if i != 0 {
+			_, _ = b.WriteString("\n")
+		}
+		_, _ = fmt.Fprintf(&b, "%s\n↳ %s\n", pair.Orig, pair.Trans)
+	}
+	return b.String()
+}
+
 func concatAuthors(authors []string) string {
 	var b strings.Builder
 	for i, author := range authors {
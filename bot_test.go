@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/nlopes/slack"
+	"github.com/reiyw/paperbot/translate"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeTranslator makes the translate package talk to a server that
+// translates into "ja" by upper-casing each sentence, and fails for the
+// other languages.
+func fakeTranslator(t *testing.T) func() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("tl") != "ja" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var sentences []map[string]string
+		for _, s := range strings.SplitAfter(r.URL.Query().Get("q"), ". ") {
+			sentences = append(sentences, map[string]string{"orig": s, "trans": strings.ToUpper(s)})
+		}
+		assert.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{"sentences": sentences}))
+	}))
+	proxy, _ := url.Parse(server.URL)
+	client, cache := translate.DefaultClient, translate.DefaultCache
+	translate.DefaultClient = translate.NewClient(5*time.Second, proxy)
+	translate.DefaultClient.MaxRetries = 0
+	translate.DefaultCache = nil
+	return func() {
+		translate.DefaultClient, translate.DefaultCache = client, cache
+		server.Close()
+	}
+}
+
+func TestFormatAligned(t *testing.T) {
+	tests := []struct {
+		pairs []translate.SentencePair
+		text  string
+	}{
+		{nil, ""},
+		{[]translate.SentencePair{{Orig: "One.", Trans: "一。"}}, "One.\n↳ 一。\n"},
+		{[]translate.SentencePair{{Orig: "One.", Trans: "一。"}, {Orig: "Two.", Trans: "二。"}}, "One.\n↳ 一。\n\nTwo.\n↳ 二。\n"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.text, formatAligned(test.pairs))
+	}
+}
+
+func TestFormatAsAttachment(t *testing.T) {
+	defer fakeTranslator(t)()
+	p := Paper{Title: "Title", AbstUrl: "https://arxiv.org/abs/1805.09547", AbstText: "Uses $M_1$. Works *well*."}
+	abstract := slack.AttachmentField{Title: "Abstract", Value: p.AbstText}
+
+	tests := []struct {
+		langs   []string
+		aligned bool
+		fields  []slack.AttachmentField
+	}{
+		{[]string{"en"}, false, []slack.AttachmentField{abstract}},
+		{[]string{"ja"}, false, []slack.AttachmentField{abstract, {Title: "概要", Value: "USES $M_1$. WORKS *WELL*."}}},
+		{[]string{"en"}, true, []slack.AttachmentField{abstract}},
+		{[]string{"ja"}, true, []slack.AttachmentField{{Title: "Abstract / 概要", Value: "Uses $M_1$.\n↳ USES $M_1$.\n\nWorks *well*.\n↳ WORKS *WELL*.\n"}}},
+		// the abstract is not lost when the translation fails
+		{[]string{"ko"}, true, []slack.AttachmentField{abstract}},
+	}
+	for _, test := range tests {
+		attachment := formatAsAttachment(p, test.langs, test.aligned)
+		assert.Equal(t, test.fields, attachment.Fields, "%v %v", test.langs, test.aligned)
+		assert.Empty(t, attachment.MarkdownIn)
+	}
+}
+
+func TestFormatTrendChange(t *testing.T) {
+	tests := []struct {
+		change TrendChange
+		marks  string
+	}{
+		{TrendChange{Rank: 1, Days: 1}, " :new:"},
+		{TrendChange{Rank: 2, PreviousRank: 2, Days: 2}, " day 2"},
+		{TrendChange{Rank: 1, PreviousRank: 5, Days: 3}, " ↑4 day 3"},
+		{TrendChange{Rank: 7, PreviousRank: 2, Days: 2}, " ↓5 day 2"},
+		// small moves are not marked
+		{TrendChange{Rank: 3, PreviousRank: 1, Days: 1}, ""},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.marks, formatTrendChange(test.change), "%+v", test.change)
+	}
+}
+
+func TestFormatTrendReason(t *testing.T) {
+	tests := []struct {
+		paper  TrendingPaper
+		reason string
+	}{
+		{TrendingPaper{Reason: "120 upvotes"}, "120 upvotes"},
+		{TrendingPaper{Reason: "85 points", DiscussionUrl: "https://news.ycombinator.com/item?id=1"}, "<https://news.ycombinator.com/item?id=1|85 points>"},
+		{TrendingPaper{Reason: "merged", Evidence: []TrendingPaper{
+			{Reason: "120 upvotes"},
+			{Reason: "85 points", DiscussionUrl: "https://news.ycombinator.com/item?id=1"},
+		}}, "120 upvotes, <https://news.ycombinator.com/item?id=1|85 points>"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.reason, formatTrendReason(test.paper))
+	}
+}
+
+func TestFormatTrendDigest(t *testing.T) {
+	paper := func(title string) Paper {
+		return Paper{Title: title, Authors: []string{"Ran Tian"}, AbstUrl: "https://arxiv.org/abs/" + title, Year: 2018}
+	}
+	entries := []trendEntry{
+		{Trend: TrendingPaper{Reason: "120 upvotes"}, Paper: paper("1805.09547"), Change: TrendChange{Rank: 1, Days: 1}},
+		{Trend: TrendingPaper{Reason: "85 points", DiscussionUrl: "https://news.ycombinator.com/item?id=1"}, Paper: paper("1805.00001"), Change: TrendChange{Rank: 4, PreviousRank: 9, Days: 2}},
+	}
+	// the papers keep their rank on the list, even if some are not shown
+	assert.Equal(t, "*Trending papers*\n"+
+		"1. [120 upvotes] :new: Ran Tian. <https://arxiv.org/abs/1805.09547 |1805.09547>. 2018\n"+
+		"4. [<https://news.ycombinator.com/item?id=1|85 points>] ↑5 day 2 Ran Tian. <https://arxiv.org/abs/1805.00001 |1805.00001>. 2018",
+		formatTrendDigest(entries))
+	// in the individual layout each paper is a message of its own
+	assert.Equal(t, "[120 upvotes] :new: Ran Tian. <https://arxiv.org/abs/1805.09547 |1805.09547>. 2018", formatTrendEntry(entries[0]))
+}
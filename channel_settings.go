@@ -0,0 +1,161 @@
+package main
+
+import "sync"
+
+const (
+	// TrendLayoutDigest posts trending papers as one numbered list with the
+	// details of each paper in its thread.
+	TrendLayoutDigest = "digest"
+	// TrendLayoutIndividual posts one message per trending paper.
+	TrendLayoutIndividual = "individual"
+)
+
+// ChannelSettings holds per-channel preferences that are kept in the store.
+type ChannelSettings struct {
+	// DefaultTrendLayout applies to channels without a layout of their own.
+	DefaultTrendLayout string
+	// DefaultTrendMode applies to channels without a mode of their own.
+	DefaultTrendMode string
+
+	store    *Store
+	mu       sync.Mutex
+	channels map[string]channelSetting
+}
+
+type channelSetting struct {
+	TrendLayout string `json:",omitempty"`
+	TrendMode   string `json:",omitempty"`
+	// Trend is set if the channel receives trending papers.
+	Trend *TrendSubscription `json:",omitempty"`
+	// Arxiv is set if the channel is alerted of new arXiv submissions.
+	Arxiv *ArxivSubscription `json:",omitempty"`
+}
+
+func NewChannelSettings(store *Store, defaultTrendLayout, defaultTrendMode string) (*ChannelSettings, error) {
+	s := &ChannelSettings{
+		DefaultTrendLayout: defaultTrendLayout,
+		DefaultTrendMode:   defaultTrendMode,
+		store:              store,
+		channels:           map[string]channelSetting{},
+	}
+	if err := store.Load("channels", &s.channels); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *ChannelSettings) TrendLayout(channel string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if layout := s.channels[channel].TrendLayout; layout != "" {
+		return layout
+	}
+	return s.DefaultTrendLayout
+}
+
+// SetTrendLayout sets the layout of channel. An empty layout resets it to the
+// default.
+func (s *ChannelSettings) SetTrendLayout(channel, layout string) error {
+	return s.update(channel, func(c *channelSetting) {
+		c.TrendLayout = layout
+	})
+}
+
+func (s *ChannelSettings) TrendMode(channel string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if mode := s.channels[channel].TrendMode; mode != "" {
+		return mode
+	}
+	return s.DefaultTrendMode
+}
+
+// SetTrendMode sets the mode of channel. An empty mode resets it to the
+// default.
+func (s *ChannelSettings) SetTrendMode(channel, mode string) error {
+	return s.update(channel, func(c *channelSetting) {
+		c.TrendMode = mode
+	})
+}
+
+// TrendSubscriptions returns the subscriptions of all subscribed channels.
+func (s *ChannelSettings) TrendSubscriptions() map[string]TrendSubscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subs := map[string]TrendSubscription{}
+	for channel, c := range s.channels {
+		if c.Trend != nil {
+			subs[channel] = *c.Trend
+		}
+	}
+	return subs
+}
+
+func (s *ChannelSettings) TrendSubscription(channel string) (TrendSubscription, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sub := s.channels[channel].Trend; sub != nil {
+		return *sub, true
+	}
+	return TrendSubscription{}, false
+}
+
+// SetTrendSubscription subscribes channel to trending papers, or
+// unsubscribes it if sub is nil.
+func (s *ChannelSettings) SetTrendSubscription(channel string, sub *TrendSubscription) error {
+	return s.update(channel, func(c *channelSetting) {
+		c.Trend = sub
+	})
+}
+
+// ArxivSubscriptions returns the subscriptions of all channels alerted of new
+// submissions.
+func (s *ChannelSettings) ArxivSubscriptions() map[string]ArxivSubscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subs := map[string]ArxivSubscription{}
+	for channel, c := range s.channels {
+		if c.Arxiv != nil {
+			subs[channel] = *c.Arxiv
+		}
+	}
+	return subs
+}
+
+func (s *ChannelSettings) ArxivSubscription(channel string) (ArxivSubscription, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sub := s.channels[channel].Arxiv; sub != nil {
+		return *sub, true
+	}
+	return ArxivSubscription{}, false
+}
+
+// SetArxivSubscription subscribes channel to new submissions, or
+// unsubscribes it if sub is nil.
+func (s *ChannelSettings) SetArxivSubscription(channel string, sub *ArxivSubscription) error {
+	return s.update(channel, func(c *channelSetting) {
+		c.Arxiv = sub
+	})
+}
+
+// update applies f to the settings of channel and saves them.
+func (s *ChannelSettings) update(channel string, f func(*channelSetting)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.channels[channel]
+	f(&c)
+	s.channels[channel] = c
+	return s.store.Save("channels", s.channels)
+}
+
+func isTrendLayout(layout string) bool {
+	return layout == TrendLayoutDigest || layout == TrendLayoutIndividual
+}
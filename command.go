@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"github.com/nlopes/slack"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ignoreMessage reports whether ev is to be left alone: RTM echoes the
+// bot's own messages, other bots are not talked to, and edits and deletions
+// of messages were handled when the messages were posted.
+func ignoreMessage(ev *slack.MessageEvent, botUserId string) bool {
+	if ev.User == botUserId || ev.BotID != "" {
+		return true
+	}
+	switch ev.SubType {
+	case "bot_message", "message_changed", "message_deleted", "message_replied":
+		return true
+	}
+	return false
+}
+
+// parseCommand splits a message sent to channel into a command name and its
+// arguments, ignoring a mention of the bot. Only direct messages and
+// messages mentioning the bot are commands; the name is empty otherwise.
+func parseCommand(text, channel, botUserId string) (string, []string) {
+	mention := fmt.Sprintf("<@%s>", botUserId)
+	if !strings.HasPrefix(channel, "D") && !strings.Contains(text, mention) {
+		return "", nil
+	}
+	text = strings.Replace(text, mention, "", 1)
+	fields := splitArgs(text)
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return strings.ToLower(fields[0]), fields[1:]
+}
+
+// splitArgs splits text at spaces except inside double quotes, so that
+// `include "knowledge graph"` has two arguments. Slack's curly quotes are
+// accepted as well.
+func splitArgs(text string) []string {
+	var args []string
+	var b strings.Builder
+	quoted, inArg := false, false
+	for _, r := range text {
+		switch {
+		case r == '"' || r == '“' || r == '”':
+			quoted = !quoted
+			inArg = true
+		case !quoted && unicode.IsSpace(r):
+			if inArg {
+				args = append(args, b.String())
+				b.Reset()
+				inArg = false
+			}
+		default:
+			_, _ = b.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, b.String())
+	}
+	return args
+}
+
+const langUsage = "Usage: `lang`, `lang me <code>|default`, `lang channel <code>...|default`"
+
+// langCommand shows or changes the language preferences of the user and the
+// channel the command was sent from.
+func langCommand(langs *Languages, args []string, user, channel string) string {
+	if len(args) == 0 {
+		userLang, ok := langs.UserLanguage(user)
+		if !ok {
+			userLang = "default"
+		}
+		return fmt.Sprintf("Your language: %s\nThis channel: %s",
+			userLang, strings.Join(langs.ChannelLanguages(channel), ", "))
+	}
+	if len(args) < 2 {
+		return langUsage
+	}
+
+	var codes []string
+	if args[1] != "default" {
+		for _, arg := range args[1:] {
+			for _, code := range strings.Split(arg, ",") {
+				if code == "" {
+					continue
+				}
+				lang, ok := normalizeLanguage(code)
+				if !ok {
+					return fmt.Sprintf("Unsupported language: %s", code)
+				}
+				codes = append(codes, lang)
+			}
+		}
+	}
+
+	var err error
+	switch args[0] {
+	case "me":
+		if len(codes) > 1 {
+			return langUsage
+		}
+		lang := ""
+		if len(codes) == 1 {
+			lang = codes[0]
+		}
+		err = langs.SetUser(user, lang)
+	case "channel":
+		err = langs.SetChannel(channel, codes)
+	default:
+		return langUsage
+	}
+	if err != nil {
+		storeLog.Error("store error", "error", err)
+		return "Failed to save the language setting."
+	}
+	return "OK"
+}
+
+const trendUsage = "Usage: `trend`, `trend subscribe`, `trend unsubscribe`, `trend layout digest|individual|default`, " +
+	"`trend mode new|movers|full|default`, `trend filter [categories|include|exclude <value>...|min <score>|clear]`"
+
+// trendCommand changes how trending papers are posted to the channel the
+// command was sent from.
+func trendCommand(settings *ChannelSettings, args []string, channel string) string {
+	if len(args) == 0 {
+		return trendUsage
+	}
+	if args[0] == "filter" || args[0] == "subscribe" || args[0] == "unsubscribe" {
+		return trendFilterCommand(settings, args, channel)
+	}
+	if len(args) != 2 {
+		return trendUsage
+	}
+	value := args[1]
+	if value == "default" {
+		value = ""
+	}
+
+	var err error
+	switch args[0] {
+	case "layout":
+		if value != "" && !isTrendLayout(value) {
+			return trendUsage
+		}
+		err = settings.SetTrendLayout(channel, value)
+	case "mode":
+		if value != "" && !isTrendMode(value) {
+			return trendUsage
+		}
+		err = settings.SetTrendMode(channel, value)
+	default:
+		return trendUsage
+	}
+	if err != nil {
+		storeLog.Error("store error", "error", err)
+		return "Failed to save the setting."
+	}
+	return "OK"
+}
+
+// trendFilterCommand subscribes the channel to trending papers and changes
+// which of them it receives. Setting a filter subscribes the channel.
+func trendFilterCommand(settings *ChannelSettings, args []string, channel string) string {
+	sub, subscribed := settings.TrendSubscription(channel)
+	switch {
+	case args[0] == "unsubscribe":
+		if err := settings.SetTrendSubscription(channel, nil); err != nil {
+			storeLog.Error("store error", "error", err)
+			return "Failed to save the subscription."
+		}
+		return "OK"
+	case args[0] == "subscribe":
+	case len(args) == 1:
+		if !subscribed {
+			return "This channel is not subscribed to trending papers."
+		}
+		return "Trending papers in this channel: " + sub.String()
+	case args[1] == "clear":
+		sub = TrendSubscription{}
+	case len(args) < 3:
+		return trendUsage
+	case args[1] == "categories":
+		sub.Categories = args[2:]
+	case args[1] == "include":
+		sub.Include = args[2:]
+	case args[1] == "exclude":
+		sub.Exclude = args[2:]
+	case args[1] == "min":
+		min, err := strconv.ParseFloat(args[2], 64)
+		if err != nil {
+			return trendUsage
+		}
+		sub.MinScore = min
+	default:
+		return trendUsage
+	}
+
+	if err := settings.SetTrendSubscription(channel, &sub); err != nil {
+		storeLog.Error("store error", "error", err)
+		return "Failed to save the subscription."
+	}
+	return "Trending papers in this channel: " + sub.String()
+}
+
+const arxivUsage = "Usage: `arxiv`, `arxiv subscribe <category>...`, `arxiv include|exclude <keyword>...`, `arxiv unsubscribe`"
+
+// arxivCommand subscribes the channel the command was sent from, which may
+// be a direct message, to new arXiv submissions.
+func arxivCommand(settings *ChannelSettings, args []string, channel string) string {
+	sub, subscribed := settings.ArxivSubscription(channel)
+	switch {
+	case len(args) == 0:
+		if !subscribed {
+			return "This channel is not subscribed to new submissions."
+		}
+		return "New submissions in this channel: " + sub.String()
+	case args[0] == "unsubscribe":
+		if err := settings.SetArxivSubscription(channel, nil); err != nil {
+			storeLog.Error("store error", "error", err)
+			return "Failed to save the subscription."
+		}
+		return "OK"
+	case args[0] == "subscribe" && len(args) > 1:
+		sub.Categories = args[1:]
+	case !subscribed && (args[0] == "include" || args[0] == "exclude"):
+		return "Subscribe to categories first: `arxiv subscribe cs.CL`"
+	case args[0] == "include":
+		sub.Include = args[1:]
+	case args[0] == "exclude":
+		sub.Exclude = args[1:]
+	default:
+		return arxivUsage
+	}
+
+	if err := settings.SetArxivSubscription(channel, &sub); err != nil {
+		storeLog.Error("store error", "error", err)
+		return "Failed to save the subscription."
+	}
+	return "New submissions in this channel: " + sub.String()
+}
+
+const subscribeUsage = "Usage: `subscribe`, `subscribe author|keyword <value>`, `unsubscribe author|keyword <value>`"
+
+// subscribeCommand shows or changes the authors and keywords the user
+// follows. Quoted values such as `"Kentaro Inui"` are one argument.
+func subscribeCommand(subs *UserSubscriptions, name string, args []string, user string) string {
+	if len(args) == 0 && name == "subscribe" {
+		authors, keywords := subs.Subscriptions(user)
+		if len(authors) == 0 && len(keywords) == 0 {
+			return "You are not subscribed to any authors or keywords."
+		}
+		var parts []string
+		if len(authors) > 0 {
+			parts = append(parts, "authors: "+strings.Join(quoteAll(authors), ", "))
+		}
+		if len(keywords) > 0 {
+			parts = append(parts, "keywords: "+strings.Join(quoteAll(keywords), ", "))
+		}
+		return "Your subscriptions: " + strings.Join(parts, "; ")
+	}
+	if len(args) < 2 || !isSubscriptionKind(args[0]) {
+		return subscribeUsage
+	}
+	value := strings.Join(args[1:], " ")
+
+	var err error
+	if name == "subscribe" {
+		err = subs.Subscribe(user, args[0], value)
+	} else {
+		err = subs.Unsubscribe(user, args[0], value)
+	}
+	if err != nil {
+		storeLog.Error("store error", "error", err)
+		return "Failed to save the subscription."
+	}
+	return "OK"
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"github.com/nlopes/slack"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	assert.Equal(t, []string{"trend", "filter", "include", "knowledge graph", "kg"},
+		splitArgs(`trend filter include "knowledge graph" kg`))
+	assert.Equal(t, []string{"subscribe", "author", "Kentaro Inui"},
+		splitArgs(" subscribe  author “Kentaro Inui” "))
+	assert.Equal(t, []string{"a", ""}, splitArgs(`a ""`))
+	assert.Nil(t, splitArgs("  "))
+}
+
+func TestTrendCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "paperbot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store, err := NewStore(dir)
+	assert.NoError(t, err)
+	settings, err := NewChannelSettings(store, TrendLayoutDigest, TrendModeNew)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		args   string
+		reply  string
+		layout string
+		mode   string
+	}{
+		{"layout individual", "OK", TrendLayoutIndividual, TrendModeNew},
+		{"mode movers", "OK", TrendLayoutIndividual, TrendModeMovers},
+		{"layout grid", trendUsage, TrendLayoutIndividual, TrendModeMovers},
+		{"layout", trendUsage, TrendLayoutIndividual, TrendModeMovers},
+		{"layout default", "OK", TrendLayoutDigest, TrendModeMovers},
+		{"mode default", "OK", TrendLayoutDigest, TrendModeNew},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.reply, trendCommand(settings, splitArgs(test.args), "C1"), test.args)
+		assert.Equal(t, test.layout, settings.TrendLayout("C1"), test.args)
+		assert.Equal(t, test.mode, settings.TrendMode("C1"), test.args)
+	}
+	// other channels keep the default
+	assert.Equal(t, "OK", trendCommand(settings, splitArgs("layout individual"), "C1"))
+	assert.Equal(t, TrendLayoutDigest, settings.TrendLayout("C2"))
+}
+
+func TestIgnoreMessage(t *testing.T) {
+	message := func(user, botId, subType string) *slack.MessageEvent {
+		return &slack.MessageEvent{Msg: slack.Msg{User: user, BotID: botId, SubType: subType}}
+	}
+	tests := []struct {
+		ev      *slack.MessageEvent
+		ignored bool
+	}{
+		{message("U1", "", ""), false},
+		{message("U1", "", "thread_broadcast"), false},
+		// the bot's own messages come back over RTM
+		{message("UBOT", "", ""), true},
+		{message("", "B1", "bot_message"), true},
+		{message("U2", "B2", ""), true},
+		{message("", "", "message_changed"), true},
+		{message("", "", "message_deleted"), true},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.ignored, ignoreMessage(test.ev, "UBOT"), "%+v", test.ev.Msg)
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		text, channel string
+		name          string
+		args          []string
+	}{
+		{"<@UBOT> trend mode movers", "C1", "trend", []string{"mode", "movers"}},
+		{"Lang me ko", "D1", "lang", []string{"me", "ko"}},
+		{"refresh <@UBOT> <https://arxiv.org/abs/1805.09547>", "G1", "refresh", []string{"<https://arxiv.org/abs/1805.09547>"}},
+		// messages in channels are commands only if they mention the bot
+		{"arxiv <https://arxiv.org/abs/1805.09547>", "C1", "", nil},
+		{"subscribe to the newsletter", "G1", "", nil},
+		{"<@UOTHER> schedule", "C1", "", nil},
+		{"<@UBOT>", "C1", "", nil},
+	}
+	for _, test := range tests {
+		name, args := parseCommand(test.text, test.channel, "UBOT")
+		assert.Equal(t, test.name, name, test.text)
+		assert.Equal(t, test.args, args, test.text)
+	}
+}
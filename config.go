@@ -0,0 +1,539 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/joho/godotenv"
+	"github.com/reiyw/paperbot/logging"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Config is the configuration of the bot. It is read from a YAML file, if
+// any, and every setting can be overridden by the environment variable in
+// its env tag. Settings tagged reload are applied again on SIGHUP; the
+// others take a restart.
+type Config struct {
+	Slack     SlackConfig     `yaml:"slack"`
+	Storage   StorageConfig   `yaml:"storage"`
+	Log       LogConfig       `yaml:"log"`
+	HTTP      HTTPConfig      `yaml:"http"`
+	Translate TranslateConfig `yaml:"translate"`
+	Trend     TrendConfig     `yaml:"trend"`
+	Fetch     FetchConfig     `yaml:"fetch"`
+	Schedule  ScheduleConfig  `yaml:"schedule"`
+	Shutdown  ShutdownConfig  `yaml:"shutdown"`
+}
+
+type SlackConfig struct {
+	Token       string `yaml:"token" env:"PAPERBOT_SLACK_TOKEN" secret:"true"`
+	BotUserId   string `yaml:"bot_user_id" env:"BOT_USER_ID"`
+	BotUserName string `yaml:"bot_user_name" env:"BOT_USER_NAME"`
+	BotIconUrl  string `yaml:"bot_icon_url" env:"BOT_ICON_URL"`
+	// TrendChannelId always receives the unfiltered trending papers.
+	TrendChannelId string `yaml:"trend_channel_id" env:"ARXIV_TREND_CHANNEL_ID"`
+}
+
+type StorageConfig struct {
+	DataDir string `yaml:"data_dir" env:"PAPERBOT_DATA_DIR"`
+}
+
+type LogConfig struct {
+	Format string `yaml:"format" env:"LOG_FORMAT" reload:"true"`
+	Level  string `yaml:"level" env:"LOG_LEVEL" reload:"true"`
+	Redact bool   `yaml:"redact" env:"LOG_REDACT" reload:"true"`
+}
+
+type HTTPConfig struct {
+	// Addr is where health and metrics are served, or "off".
+	Addr string `yaml:"addr" env:"HTTP_ADDR"`
+}
+
+type TranslateConfig struct {
+	CacheTTL        Duration `yaml:"cache_ttl" env:"TRANSLATE_CACHE_TTL"`
+	CacheDir        string   `yaml:"cache_dir" env:"TRANSLATE_CACHE_DIR"`
+	Timeout         Duration `yaml:"timeout" env:"TRANSLATE_TIMEOUT"`
+	Proxy           string   `yaml:"proxy" env:"TRANSLATE_PROXY" secret:"true"`
+	Pairs           string   `yaml:"pairs" env:"TRANSLATE_PAIRS"`
+	DefaultLang     string   `yaml:"default_lang" env:"TRANSLATE_DEFAULT_LANG"`
+	DetectThreshold float64  `yaml:"detect_threshold" env:"DETECT_THRESHOLD"`
+	AlignAbstracts  bool     `yaml:"align_abstracts" env:"ALIGN_ABSTRACTS"`
+}
+
+type TrendConfig struct {
+	Source  string `yaml:"source" env:"TREND_SOURCE"`
+	FeedUrl string `yaml:"feed_url" env:"TREND_FEED_URL"`
+	Limit   int    `yaml:"limit" env:"TREND_LIMIT"`
+	Layout  string `yaml:"layout" env:"TREND_LAYOUT"`
+	Mode    string `yaml:"mode" env:"TREND_MODE"`
+}
+
+type FetchConfig struct {
+	Workers          int      `yaml:"workers" env:"FETCH_WORKERS"`
+	HostIntervals    string   `yaml:"host_intervals" env:"FETCH_HOST_INTERVALS" reload:"true"`
+	CacheTTL         Duration `yaml:"cache_ttl" env:"PAPER_CACHE_TTL" reload:"true"`
+	CacheNegativeTTL Duration `yaml:"cache_negative_ttl" env:"PAPER_CACHE_NEGATIVE_TTL" reload:"true"`
+}
+
+type ScheduleConfig struct {
+	Timezone       string `yaml:"timezone" env:"SCHEDULE_TIMEZONE"`
+	SkipWeekends   bool   `yaml:"skip_weekends" env:"SCHEDULE_SKIP_WEEKENDS"`
+	Holidays       string `yaml:"holidays" env:"SCHEDULE_HOLIDAYS"`
+	Trending       string `yaml:"trending" env:"SCHEDULE_TRENDING"`
+	NewSubmissions string `yaml:"new_submissions" env:"SCHEDULE_NEW_SUBMISSIONS"`
+	WeeklyDigest   string `yaml:"weekly_digest" env:"SCHEDULE_WEEKLY_DIGEST"`
+	Notifications  string `yaml:"notifications" env:"SCHEDULE_NOTIFICATIONS"`
+}
+
+type ShutdownConfig struct {
+	// Timeout is how long to wait for work in flight and to post the
+	// messages pending on shutdown.
+	Timeout Duration `yaml:"timeout" env:"SHUTDOWN_TIMEOUT"`
+}
+
+// Duration is a time.Duration written as "24h" or "1h30m" in the file.
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if value.Kind != yaml.ScalarNode || value.Decode(&s) != nil {
+		return fmt.Errorf("line %d: duration must be written such as 24h", value.Line)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("line %d: %s", value.Line, err)
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// DefaultConfig returns the settings used when neither the file nor the
+// environment sets them.
+func DefaultConfig() *Config {
+	return &Config{
+		Storage: StorageConfig{DataDir: "data"},
+		Log:     LogConfig{Format: logging.FormatLogfmt, Level: "info", Redact: true},
+		HTTP:    HTTPConfig{Addr: ":8080"},
+		Translate: TranslateConfig{
+			CacheTTL:        Duration{30 * 24 * time.Hour},
+			Timeout:         Duration{25 * time.Second},
+			Pairs:           "ja:en,en:ja",
+			DefaultLang:     "ja",
+			DetectThreshold: 0.6,
+		},
+		Trend: TrendConfig{
+			Source: "huggingface",
+			Limit:  10,
+			Layout: TrendLayoutDigest,
+			Mode:   TrendModeNew,
+		},
+		// arXiv asks to keep to one request every three seconds
+		Fetch: FetchConfig{
+			Workers:          4,
+			HostIntervals:    "arxiv.org=3s,export.arxiv.org=3s",
+			CacheTTL:         Duration{24 * time.Hour},
+			CacheNegativeTTL: Duration{time.Hour},
+		},
+		Schedule: ScheduleConfig{
+			Trending: "0 12 * * *",
+			// the listings tell whether there is a new announcement, so
+			// checking every hour catches it soon after it is out
+			NewSubmissions: "0 * * * *",
+			WeeklyDigest:   "off",
+			Notifications:  "30 * * * *",
+		},
+		Shutdown: ShutdownConfig{Timeout: Duration{30 * time.Second}},
+	}
+}
+
+// defaultConfigPath is read if it exists and PAPERBOT_CONFIG is not set.
+const defaultConfigPath = "paperbot.yaml"
+
+// configPath returns the file to read the configuration from and whether
+// it must exist.
+func configPath(lookupEnv func(string) (string, bool)) (string, bool) {
+	if path, ok := lookupEnv("PAPERBOT_CONFIG"); ok && path != "" {
+		return path, true
+	}
+	return defaultConfigPath, false
+}
+
+// configEnv returns a lookup of the environment falling back to .env, if
+// there is one.
+func configEnv() (func(string) (string, bool), error) {
+	dotenv, err := godotenv.Read()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf(".env: %s", err)
+	}
+	return func(name string) (string, bool) {
+		if value, ok := os.LookupEnv(name); ok {
+			return value, true
+		}
+		value, ok := dotenv[name]
+		return value, ok
+	}, nil
+}
+
+// LoadConfig reads the configuration from the file, if any, and the
+// environment. It does not validate it.
+//
+// Empty environment variables are ignored, as the .env file lists every
+// variable whether or not it is set, so a setting of the file cannot be
+// cleared from the environment; it has to be removed from the file.
+func LoadConfig(lookupEnv func(string) (string, bool)) (*Config, error) {
+	c := DefaultConfig()
+
+	path, required := configPath(lookupEnv)
+	data, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err) && !required:
+	case err != nil:
+		return nil, err
+	default:
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		// an empty file sets nothing
+		if err := dec.Decode(c); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+	}
+
+	var errs ConfigErrors
+	eachSetting(c, func(field reflect.StructField, v reflect.Value) {
+		env := field.Tag.Get("env")
+		s, ok := lookupEnv(env)
+		if !ok || s == "" {
+			return
+		}
+		if err := setFromString(v, s); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", env, err))
+		}
+	})
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return c, nil
+}
+
+// eachSetting calls f with every setting of c.
+func eachSetting(c *Config, f func(field reflect.StructField, v reflect.Value)) {
+	sections := reflect.ValueOf(c).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		section := sections.Field(i)
+		for j := 0; j < section.NumField(); j++ {
+			f(section.Type().Field(j), section.Field(j))
+		}
+	}
+}
+
+func setFromString(v reflect.Value, s string) error {
+	switch v.Interface().(type) {
+	case Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(Duration{d}))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("not true or false: %q", s)
+		}
+		v.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("not an integer: %q", s)
+		}
+		v.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("not a number: %q", s)
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+// ConfigErrors lists everything wrong with a configuration.
+type ConfigErrors []string
+
+func (e ConfigErrors) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e, "\n  ")
+}
+
+// Validate checks every setting and returns ConfigErrors naming the wrong
+// ones, or nil.
+func (c *Config) Validate() error {
+	var errs ConfigErrors
+	check := func(env string, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", env, err))
+		}
+	}
+
+	if c.Slack.Token == "" {
+		check("PAPERBOT_SLACK_TOKEN", fmt.Errorf("required"))
+	}
+	if c.Storage.DataDir == "" {
+		check("PAPERBOT_DATA_DIR", fmt.Errorf("required"))
+	}
+
+	if format := strings.ToLower(c.Log.Format); format != logging.FormatLogfmt && format != logging.FormatJSON {
+		check("LOG_FORMAT", fmt.Errorf("must be %s or %s", logging.FormatLogfmt, logging.FormatJSON))
+	}
+	_, _, err := logging.ParseLevels(c.Log.Level)
+	check("LOG_LEVEL", err)
+
+	if c.HTTP.Addr != "off" {
+		if _, port, err := net.SplitHostPort(c.HTTP.Addr); err != nil {
+			check("HTTP_ADDR", err)
+		} else if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			check("HTTP_ADDR", fmt.Errorf("invalid port %q", port))
+		}
+	}
+
+	check("TRANSLATE_CACHE_TTL", nonNegative(c.Translate.CacheTTL))
+	if c.Translate.Timeout.Duration <= 0 {
+		check("TRANSLATE_TIMEOUT", fmt.Errorf("must be positive"))
+	}
+	if c.Translate.Proxy != "" {
+		if _, err := url.Parse(c.Translate.Proxy); err != nil {
+			// the error would show the proxy's credentials
+			check("TRANSLATE_PROXY", fmt.Errorf("not a URL"))
+		}
+	}
+	_, err = ParseLanguagePairs(c.Translate.Pairs)
+	check("TRANSLATE_PAIRS", err)
+	if _, ok := normalizeLanguage(c.Translate.DefaultLang); !ok {
+		check("TRANSLATE_DEFAULT_LANG", fmt.Errorf("unsupported language: %q", c.Translate.DefaultLang))
+	}
+	if c.Translate.DetectThreshold < 0 || c.Translate.DetectThreshold > 1 {
+		check("DETECT_THRESHOLD", fmt.Errorf("must be between 0 and 1"))
+	}
+
+	_, err = parseTrendSources(c.Trend.Source, c.Trend.FeedUrl)
+	check("TREND_SOURCE", err)
+	if c.Trend.Limit < 1 {
+		check("TREND_LIMIT", fmt.Errorf("must be at least 1"))
+	}
+	if !isTrendLayout(c.Trend.Layout) {
+		check("TREND_LAYOUT", fmt.Errorf("must be %s or %s", TrendLayoutDigest, TrendLayoutIndividual))
+	}
+	if !isTrendMode(c.Trend.Mode) {
+		check("TREND_MODE", fmt.Errorf("must be %s, %s or %s", TrendModeNew, TrendModeMovers, TrendModeFull))
+	}
+
+	if c.Fetch.Workers < 1 {
+		check("FETCH_WORKERS", fmt.Errorf("must be at least 1"))
+	}
+	_, err = ParseHostIntervals(c.Fetch.HostIntervals)
+	check("FETCH_HOST_INTERVALS", err)
+	check("PAPER_CACHE_TTL", nonNegative(c.Fetch.CacheTTL))
+	check("PAPER_CACHE_NEGATIVE_TTL", nonNegative(c.Fetch.CacheNegativeTTL))
+
+	loc, err := c.Schedule.Location()
+	check("SCHEDULE_TIMEZONE", err)
+	holidays, err := ParseHolidays(c.Schedule.Holidays)
+	check("SCHEDULE_HOLIDAYS", err)
+	if loc != nil {
+		for _, job := range c.Schedule.jobs() {
+			if job.expr == "off" {
+				continue
+			}
+			schedule, err := ParseSchedule(job.expr, loc)
+			if err != nil {
+				check(job.env, err)
+				continue
+			}
+			schedule.SkipWeekends = c.Schedule.SkipWeekends
+			schedule.Holidays = holidays
+			if schedule.Next(time.Now()).IsZero() {
+				check(job.env, fmt.Errorf("never runs on a day that is not skipped"))
+			}
+		}
+	}
+
+	if c.Shutdown.Timeout.Duration <= 0 {
+		check("SHUTDOWN_TIMEOUT", fmt.Errorf("must be positive"))
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func nonNegative(d Duration) error {
+	if d.Duration < 0 {
+		return fmt.Errorf("must not be negative")
+	}
+	return nil
+}
+
+// logging returns the configuration of the logging package.
+func (c LogConfig) logging() (logging.Config, error) {
+	config := logging.Config{Format: strings.ToLower(c.Format), Redact: c.Redact}
+	var err error
+	config.Level, config.Levels, err = logging.ParseLevels(c.Level)
+	return config, err
+}
+
+// Location returns the time zone jobs are scheduled in.
+func (c ScheduleConfig) Location() (*time.Location, error) {
+	if c.Timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(c.Timezone)
+}
+
+type scheduledJob struct {
+	name, env, expr string
+}
+
+func (c ScheduleConfig) jobs() []scheduledJob {
+	return []scheduledJob{
+		{"trending", "SCHEDULE_TRENDING", c.Trending},
+		{"new submissions", "SCHEDULE_NEW_SUBMISSIONS", c.NewSubmissions},
+		{"weekly digest", "SCHEDULE_WEEKLY_DIGEST", c.WeeklyDigest},
+		{"notifications", "SCHEDULE_NOTIFICATIONS", c.Notifications},
+	}
+}
+
+// RestartRequired returns the environment variables of the settings that
+// differ between c and next but are only applied on start-up.
+func (c *Config) RestartRequired(next *Config) []string {
+	var fields []reflect.StructField
+	var values []reflect.Value
+	eachSetting(c, func(field reflect.StructField, v reflect.Value) {
+		fields = append(fields, field)
+		values = append(values, v)
+	})
+	var changed []string
+	i := 0
+	eachSetting(next, func(field reflect.StructField, v reflect.Value) {
+		if field.Tag.Get("reload") != "true" && !reflect.DeepEqual(values[i].Interface(), v.Interface()) {
+			changed = append(changed, fields[i].Tag.Get("env"))
+		}
+		i++
+	})
+	return changed
+}
+
+// Reloaded returns c with the settings applied on SIGHUP taken from next.
+func (c *Config) Reloaded(next *Config) *Config {
+	reloaded := *c
+	var values []reflect.Value
+	eachSetting(next, func(_ reflect.StructField, v reflect.Value) {
+		values = append(values, v)
+	})
+	i := 0
+	eachSetting(&reloaded, func(field reflect.StructField, v reflect.Value) {
+		if field.Tag.Get("reload") == "true" {
+			v.Set(values[i])
+		}
+		i++
+	})
+	return &reloaded
+}
+
+// Redacted returns c as YAML with its secrets hidden, to be shown.
+func (c *Config) Redacted() string {
+	redacted := *c
+	eachSetting(&redacted, func(field reflect.StructField, v reflect.Value) {
+		if field.Tag.Get("secret") == "true" && v.String() != "" {
+			v.SetString("[redacted]")
+		}
+	})
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	_ = enc.Encode(redacted)
+	_ = enc.Close()
+	return b.String()
+}
+
+// loadConfig reads and validates the configuration.
+func loadConfig() (*Config, error) {
+	lookupEnv, err := configEnv()
+	if err != nil {
+		return nil, err
+	}
+	c, err := LoadConfig(lookupEnv)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// reloadOnHangup reads the configuration again on every SIGHUP until ctx is
+// done and passes it to apply, unless it is invalid.
+func reloadOnHangup(ctx context.Context, current *Config, apply func(*Config)) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+		}
+		next, err := loadConfig()
+		if err != nil {
+			configLog.Error("keeping the configuration", "error", err)
+			continue
+		}
+		for _, setting := range current.RestartRequired(next) {
+			configLog.Warn("setting changed, restart to apply", "setting", setting)
+		}
+		// the others keep their values until a restart, so that the next
+		// reload warns about them again
+		current = current.Reloaded(next)
+		apply(current)
+		configLog.Info("configuration reloaded")
+	}
+}
+
+// configCommand runs "paperbot config check", printing the configuration
+// or what is wrong with it, and returns the exit code.
+func configCommand(args []string) int {
+	if len(args) != 1 || args[0] != "check" {
+		fmt.Fprintln(os.Stderr, "Usage: paperbot config check")
+		return 2
+	}
+	c, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println(c.Redacted())
+	return 0
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func lookupIn(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "paperbot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "paperbot.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`
+slack:
+  token: xoxb-file
+  trend_channel_id: C1
+trend:
+  limit: 5
+  mode: movers
+fetch:
+  cache_ttl: 12h
+`), 0644))
+
+	c, err := LoadConfig(lookupIn(map[string]string{
+		"PAPERBOT_CONFIG":          path,
+		"PAPERBOT_SLACK_TOKEN":     "xoxb-env",
+		"TREND_LIMIT":              "20",
+		"SCHEDULE_SKIP_WEEKENDS":   "true",
+		"PAPER_CACHE_NEGATIVE_TTL": "5m",
+		// empty variables, as in a .env file filled in partly, are ignored
+		"TREND_LAYOUT": "",
+	}))
+	assert.NoError(t, err)
+	assert.NoError(t, c.Validate())
+	// the environment overrides the file, which overrides the defaults
+	assert.Equal(t, "xoxb-env", c.Slack.Token)
+	assert.Equal(t, "C1", c.Slack.TrendChannelId)
+	assert.Equal(t, 20, c.Trend.Limit)
+	assert.Equal(t, TrendModeMovers, c.Trend.Mode)
+	assert.Equal(t, TrendLayoutDigest, c.Trend.Layout)
+	assert.Equal(t, 12*time.Hour, c.Fetch.CacheTTL.Duration)
+	assert.Equal(t, 5*time.Minute, c.Fetch.CacheNegativeTTL.Duration)
+	assert.True(t, c.Schedule.SkipWeekends)
+
+	// a config file that was asked for must exist
+	_, err = LoadConfig(lookupIn(map[string]string{"PAPERBOT_CONFIG": filepath.Join(dir, "missing.yaml")}))
+	assert.Error(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("trend:\n  limits: 5\n"), 0644))
+	_, err = LoadConfig(lookupIn(map[string]string{"PAPERBOT_CONFIG": path}))
+	assert.EqualError(t, err, path+": yaml: unmarshal errors:\n  line 2: field limits not found in type main.TrendConfig")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("fetch:\n  cache_ttl: 12\n"), 0644))
+	_, err = LoadConfig(lookupIn(map[string]string{"PAPERBOT_CONFIG": path}))
+	assert.EqualError(t, err, path+`: line 2: time: missing unit in duration "12"`)
+
+	// an empty file sets nothing
+	assert.NoError(t, ioutil.WriteFile(path, nil, 0644))
+	c, err = LoadConfig(lookupIn(map[string]string{"PAPERBOT_CONFIG": path}))
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultConfig(), c)
+
+	_, err = LoadConfig(lookupIn(map[string]string{"TREND_LIMIT": "ten", "PAPER_CACHE_TTL": "1 day"}))
+	assert.Error(t, err)
+	assert.Len(t, err.(ConfigErrors), 2)
+}
+
+func TestConfigValidate(t *testing.T) {
+	c := DefaultConfig()
+	c.Slack.Token = "xoxb-token"
+	assert.NoError(t, c.Validate())
+
+	c.Slack.Token = ""
+	c.Log.Level = "loud"
+	c.HTTP.Addr = "8080"
+	c.Translate.DefaultLang = "klingon"
+	c.Trend.Source = "twitter"
+	c.Fetch.Workers = 0
+	c.Schedule.Timezone = "Mars/Olympus"
+	c.Schedule.WeeklyDigest = "every friday"
+	err := c.Validate()
+	assert.Error(t, err)
+	errs := err.(ConfigErrors)
+	assert.Len(t, errs, 7)
+	assert.Contains(t, errs, "PAPERBOT_SLACK_TOKEN: required")
+	assert.Contains(t, errs, `TRANSLATE_DEFAULT_LANG: unsupported language: "klingon"`)
+	assert.Contains(t, errs, "FETCH_WORKERS: must be at least 1")
+
+	// schedules are checked once the time zone is right
+	c.Schedule.Timezone = "Asia/Tokyo"
+	assert.Contains(t, c.Validate().Error(), "SCHEDULE_WEEKLY_DIGEST: ")
+
+	c.Schedule.WeeklyDigest = "0 9 * * sun"
+	c.Schedule.SkipWeekends = true
+	assert.Contains(t, c.Validate().Error(), "SCHEDULE_WEEKLY_DIGEST: never runs on a day that is not skipped")
+}
+
+func TestConfigReload(t *testing.T) {
+	c := DefaultConfig()
+	next := DefaultConfig()
+	next.Log.Level = "debug"
+	next.Fetch.CacheTTL = Duration{time.Hour}
+	assert.Empty(t, c.RestartRequired(next))
+
+	next.Slack.Token = "xoxb-new"
+	next.Trend.Limit = 3
+	assert.Equal(t, []string{"PAPERBOT_SLACK_TOKEN", "TREND_LIMIT"}, c.RestartRequired(next))
+
+	// only the settings applied on reload are taken, so that the others are
+	// still reported on the next reload
+	reloaded := c.Reloaded(next)
+	assert.Equal(t, "debug", reloaded.Log.Level)
+	assert.Equal(t, time.Hour, reloaded.Fetch.CacheTTL.Duration)
+	assert.Equal(t, 10, reloaded.Trend.Limit)
+	assert.Equal(t, []string{"PAPERBOT_SLACK_TOKEN", "TREND_LIMIT"}, reloaded.RestartRequired(next))
+	assert.Equal(t, "info", c.Log.Level)
+}
+
+func TestConfigRedacted(t *testing.T) {
+	c := DefaultConfig()
+	c.Slack.Token = "xoxb-secret"
+	redacted := c.Redacted()
+	assert.NotContains(t, redacted, "xoxb-secret")
+	assert.Contains(t, redacted, "  token: '[redacted]'\n")
+	assert.Contains(t, redacted, "  cache_ttl: 24h0m0s\n")
+	assert.Equal(t, "xoxb-secret", c.Slack.Token)
+}
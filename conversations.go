@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/nlopes/slack"
+	"strings"
+	"sync"
+)
+
+// Conversations tells the private conversations from the public channels.
+// Channel IDs do not tell them apart, as private channels also start with
+// "C", so Slack is asked once per channel and the answer remembered.
+type Conversations struct {
+	info    func(channel string) (*slack.Channel, error)
+	mu      sync.Mutex
+	private map[string]bool
+}
+
+// NewConversations makes Conversations looking channels up with info,
+// e.g. a function calling conversations.info.
+func NewConversations(info func(channel string) (*slack.Channel, error)) *Conversations {
+	return &Conversations{info: info, private: map[string]bool{}}
+}
+
+// IsPrivate reports whether channel is a direct message or a private
+// channel. A channel that cannot be looked up is taken to be private, and
+// is looked up again the next time.
+func (c *Conversations) IsPrivate(channel string) bool {
+	if strings.HasPrefix(channel, "D") || strings.HasPrefix(channel, "G") {
+		return true
+	}
+	c.mu.Lock()
+	private, ok := c.private[channel]
+	c.mu.Unlock()
+	if ok {
+		return private
+	}
+
+	ch, err := c.info(channel)
+	if err != nil {
+		slackLog.Warn("conversation info error", "channel", channel, "error", err)
+		return true
+	}
+	private = ch.IsPrivate || ch.IsIM || ch.IsMpIM
+	c.mu.Lock()
+	c.private[channel] = private
+	c.mu.Unlock()
+	return private
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FetchResult is the outcome of fetching the paper at Url.
+type FetchResult struct {
+	Url   string
+	Paper *Paper
+	Err   error
+}
+
+// FetchPool fetches papers concurrently, at most Workers at a time and no
+// faster than the interval set for each host. Requests for a paper already
+// being fetched wait for that fetch instead of making their own.
+type FetchPool struct {
+	fetch func(rawurl string) (*Paper, error)
+	slots chan struct{}
+
+	mu        sync.Mutex
+	intervals map[string]time.Duration
+	inflight  map[string]*fetchCall
+	hosts     map[string]*hostLimiter
+	// delivered is closed once the results of the latest submission of
+	// each conversation have been delivered.
+	delivered map[string]chan struct{}
+	// submissions are the submissions not yet delivered.
+	submissions sync.WaitGroup
+}
+
+type fetchCall struct {
+	done  chan struct{}
+	paper *Paper
+	err   error
+}
+
+// hostLimiter spaces out requests to a host. Requests wait their turn
+// without holding a worker.
+type hostLimiter struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+func NewFetchPool(workers int, intervals map[string]time.Duration, fetch func(string) (*Paper, error)) *FetchPool {
+	return &FetchPool{
+		fetch:     fetch,
+		slots:     make(chan struct{}, workers),
+		intervals: intervals,
+		inflight:  map[string]*fetchCall{},
+		hosts:     map[string]*hostLimiter{},
+		delivered: map[string]chan struct{}{},
+	}
+}
+
+// SetIntervals replaces the intervals set for each host.
+func (f *FetchPool) SetIntervals(intervals map[string]time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.intervals = intervals
+}
+
+// ParseHostIntervals parses a comma-separated list of host=interval pairs
+// such as "arxiv.org=3s,aclweb.org=1s".
+func ParseHostIntervals(s string) (map[string]time.Duration, error) {
+	intervals := map[string]time.Duration{}
+	for _, pair := range strings.Split(s, ",") {
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid host interval: %q", pair)
+		}
+		interval, err := time.ParseDuration(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid host interval: %q", pair)
+		}
+		intervals[strings.ToLower(strings.TrimSpace(kv[0]))] = interval
+	}
+	return intervals, nil
+}
+
+// Fetch returns the paper at rawurl.
+func (f *FetchPool) Fetch(rawurl string) (*Paper, error) {
+	// the abstract and PDF of a paper are the same paper
+	key, err := CanonicalId(rawurl)
+	if err != nil {
+		key = rawurl
+	}
+
+	f.mu.Lock()
+	if c, ok := f.inflight[key]; ok {
+		f.mu.Unlock()
+		<-c.done
+		return c.paper, c.err
+	}
+	c := &fetchCall{done: make(chan struct{})}
+	f.inflight[key] = c
+	f.mu.Unlock()
+
+	c.paper, c.err = f.do(rawurl)
+
+	f.mu.Lock()
+	delete(f.inflight, key)
+	f.mu.Unlock()
+	close(c.done)
+	return c.paper, c.err
+}
+
+func (f *FetchPool) do(rawurl string) (paper *Paper, err error) {
+	if limiter, interval := f.limiter(rawurl); limiter != nil {
+		limiter.mu.Lock()
+		if wait := time.Until(limiter.last.Add(interval)); wait > 0 {
+			time.Sleep(wait)
+		}
+		f.slots <- struct{}{}
+		limiter.last = time.Now()
+		limiter.mu.Unlock()
+	} else {
+		f.slots <- struct{}{}
+	}
+	defer func() { <-f.slots }()
+
+	// a page the parsers do not expect must not take the bot down
+	defer func() {
+		if r := recover(); r != nil {
+			paper, err = nil, fmt.Errorf("fetching %s: %v", rawurl, r)
+		}
+	}()
+	start := time.Now()
+	paper, err = f.fetch(rawurl)
+	fetchLog.Debug("fetched", "url", rawurl, "duration", time.Since(start), "error", err)
+	return paper, err
+}
+
+// limiter returns the limiter of rawurl's host, or nil if it is not limited.
+func (f *FetchPool) limiter(rawurl string) (*hostLimiter, time.Duration) {
+	parsed, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, 0
+	}
+	host := strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	interval := f.intervals[host]
+	if interval <= 0 {
+		return nil, 0
+	}
+	limiter, ok := f.hosts[host]
+	if !ok {
+		limiter = &hostLimiter{}
+		f.hosts[host] = limiter
+	}
+	return limiter, interval
+}
+
+// FetchAll fetches the papers at urls concurrently and returns the results
+// in the order of urls.
+func (f *FetchPool) FetchAll(urls []string) []FetchResult {
+	results := make([]FetchResult, len(urls))
+	var wg sync.WaitGroup
+	for i, rawurl := range urls {
+		wg.Add(1)
+		go func(i int, rawurl string) {
+			defer wg.Done()
+			paper, err := f.Fetch(rawurl)
+			results[i] = FetchResult{Url: rawurl, Paper: paper, Err: err}
+		}(i, rawurl)
+	}
+	wg.Wait()
+	return results
+}
+
+// Submit fetches the papers at urls in the background and passes the
+// results to deliver. Submissions of the same conversation are delivered
+// in the order they were submitted, however long each takes to fetch.
+func (f *FetchPool) Submit(conversation string, urls []string, deliver func([]FetchResult)) {
+	f.mu.Lock()
+	previous := f.delivered[conversation]
+	delivered := make(chan struct{})
+	f.delivered[conversation] = delivered
+	f.mu.Unlock()
+
+	f.submissions.Add(1)
+	go func() {
+		defer f.submissions.Done()
+		results := f.FetchAll(urls)
+		if previous != nil {
+			<-previous
+		}
+		deliver(results)
+		close(delivered)
+
+		f.mu.Lock()
+		if f.delivered[conversation] == delivered {
+			delete(f.delivered, conversation)
+		}
+		f.mu.Unlock()
+	}()
+}
+
+// Wait waits for every submission to be delivered and reports whether they
+// were before ctx was done.
+func (f *FetchPool) Wait(ctx context.Context) bool {
+	return waitGroup(ctx, &f.submissions)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetchPoolOrderAndCoalescing(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	pool := NewFetchPool(4, nil, func(rawurl string) (*Paper, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		if rawurl == "https://example.com/broken" {
+			return nil, errors.New("not a paper")
+		}
+		return &Paper{AbstUrl: rawurl}, nil
+	})
+
+	urls := []string{
+		"https://arxiv.org/abs/1805.09547",
+		"https://example.com/broken",
+		// the same paper as the first, fetched once
+		"https://arxiv.org/pdf/1805.09547v2.pdf",
+	}
+	done := make(chan []FetchResult)
+	go func() { done <- pool.FetchAll(urls) }()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	results := <-done
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.Len(t, results, 3)
+	for i, r := range results {
+		assert.Equal(t, urls[i], r.Url)
+	}
+	assert.Error(t, results[1].Err)
+	assert.NotNil(t, results[0].Paper)
+	assert.True(t, results[0].Paper == results[2].Paper)
+}
+
+func TestFetchPoolLimits(t *testing.T) {
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	var arxivTimes []time.Time
+	pool := NewFetchPool(2, map[string]time.Duration{"arxiv.org": 30 * time.Millisecond}, func(rawurl string) (*Paper, error) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		if rawurl[:len("https://arxiv.org")] == "https://arxiv.org" {
+			arxivTimes = append(arxivTimes, time.Now())
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return &Paper{}, nil
+	})
+
+	pool.FetchAll([]string{
+		"https://arxiv.org/abs/1805.00001",
+		"https://arxiv.org/abs/1805.00002",
+		"https://arxiv.org/abs/1805.00003",
+		"https://aclweb.org/anthology/P18-1001",
+		"https://aclweb.org/anthology/P18-1002",
+		"https://aclweb.org/anthology/P18-1003",
+	})
+	assert.True(t, maxRunning <= 2, "%d fetches at once", maxRunning)
+	assert.Len(t, arxivTimes, 3)
+	for i := 1; i < len(arxivTimes); i++ {
+		assert.True(t, arxivTimes[i].Sub(arxivTimes[i-1]) >= 30*time.Millisecond)
+	}
+}
+
+func TestFetchPoolSubmit(t *testing.T) {
+	pool := NewFetchPool(4, nil, func(rawurl string) (*Paper, error) {
+		// the first submission takes longest
+		if rawurl == "https://example.com/slow" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		return &Paper{AbstUrl: rawurl}, nil
+	})
+
+	delivered := make(chan string, 3)
+	deliver := func(results []FetchResult) {
+		delivered <- results[0].Url
+	}
+	pool.Submit("C1", []string{"https://example.com/slow"}, deliver)
+	pool.Submit("C1", []string{"https://example.com/fast"}, deliver)
+	pool.Submit("C2", []string{"https://example.com/other"}, deliver)
+
+	// other conversations are not held up
+	assert.Equal(t, "https://example.com/other", <-delivered)
+	assert.Equal(t, "https://example.com/slow", <-delivered)
+	assert.Equal(t, "https://example.com/fast", <-delivered)
+}
+
+func TestFetchPoolRecovers(t *testing.T) {
+	pool := NewFetchPool(1, nil, func(rawurl string) (*Paper, error) {
+		var p *Paper
+		return &Paper{Title: p.Title}, nil
+	})
+	_, err := pool.Fetch("https://aclweb.org/anthology/")
+	assert.Error(t, err)
+	// the worker is released
+	_, err = pool.Fetch("https://aclweb.org/anthology/")
+	assert.Error(t, err)
+}
+
+func TestParseHostIntervals(t *testing.T) {
+	intervals, err := ParseHostIntervals("arxiv.org=3s, ACLWeb.org=500ms")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]time.Duration{"arxiv.org": 3 * time.Second, "aclweb.org": 500 * time.Millisecond}, intervals)
+	_, err = ParseHostIntervals("arxiv.org")
+	assert.Error(t, err)
+	_, err = ParseHostIntervals("arxiv.org=soon")
+	assert.Error(t, err)
+}
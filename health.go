@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"github.com/reiyw/paperbot/metrics"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	papersFetched = metrics.NewCounter("paperbot_papers_fetched_total",
+		"Papers requested, by source and outcome (fetched, cached, revalidated, stale, not_found, error).", "source", "outcome")
+	slackAPIErrors = metrics.NewCounter("paperbot_slack_api_errors_total",
+		"Errors of calls to the Slack API, by method.", "method")
+	slackReconnects = metrics.NewCounter("paperbot_slack_reconnects_total",
+		"Connections to the Slack RTM API after the first.")
+	slackConnected = metrics.NewGauge("paperbot_slack_connected",
+		"Whether the bot is connected to the Slack RTM API.")
+	trendingRuns = metrics.NewCounter("paperbot_trending_runs_total",
+		"Postings of trending papers, by outcome (ok, error).", "outcome")
+	jobRuns = metrics.NewCounter("paperbot_job_runs_total",
+		"Runs of scheduled jobs.", "job")
+	jobDuration = metrics.NewHistogram("paperbot_job_duration_seconds",
+		"How long scheduled jobs take.", []float64{1, 5, 15, 60, 300, 900}, "job")
+)
+
+// registerOutboxMetrics exposes the statistics of the outbox.
+func registerOutboxMetrics(o *Outbox) {
+	metrics.NewGaugeFunc("paperbot_outbox_depth", "Messages waiting to be posted.", func() float64 {
+		depth := 0
+		for _, n := range o.Stats().Depth {
+			depth += n
+		}
+		return float64(depth)
+	})
+	metrics.NewGaugeFunc("paperbot_outbox_dead_letters", "Messages given up on.", func() float64 {
+		return float64(o.Stats().DeadLetters)
+	})
+	metrics.NewCounterFunc("paperbot_outbox_sent_total", "Messages posted.", func() float64 {
+		return float64(o.Stats().Sent)
+	})
+	metrics.NewCounterFunc("paperbot_outbox_retries_total", "Messages posted again after a failure.", func() float64 {
+		return float64(o.Stats().Retries)
+	})
+}
+
+// sourceName names the preserver of a paper in metrics.
+func sourceName(rawurl string) string {
+	preserver, err := DetectPreserver(rawurl)
+	if err != nil {
+		return "unknown"
+	}
+	switch preserver {
+	case Arxiv:
+		return "arxiv"
+	case Aclweb:
+		return "aclweb"
+	case OpenReview:
+		return "openreview"
+	default:
+		return "unknown"
+	}
+}
+
+// Health serves whether the bot is alive and ready, and its metrics.
+type Health struct {
+	mu     sync.Mutex
+	checks map[string]func() error
+}
+
+func NewHealth() *Health {
+	return &Health{checks: map[string]func() error{}}
+}
+
+// AddCheck adds a condition for the bot to be ready; check returns why it
+// is not met.
+func (h *Health) AddCheck(name string, check func() error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = check
+}
+
+// Ready runs every check and returns the failures by name.
+func (h *Health) Ready() map[string]error {
+	h.mu.Lock()
+	checks := make(map[string]func() error, len(h.checks))
+	for name, check := range h.checks {
+		checks[name] = check
+	}
+	h.mu.Unlock()
+
+	failures := map[string]error{}
+	for name, check := range checks {
+		if err := check(); err != nil {
+			failures[name] = err
+		}
+	}
+	return failures
+}
+
+// Handler serves /healthz, which answers as long as the bot runs, /readyz,
+// which fails unless every check passes, and /metrics.
+func (h *Health) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		failures := h.Ready()
+		if len(failures) == 0 {
+			fmt.Fprintln(w, "ok")
+			return
+		}
+		var lines []string
+		for name, err := range failures {
+			lines = append(lines, fmt.Sprintf("%s: %s", name, err))
+		}
+		sort.Strings(lines)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, strings.Join(lines, "\n"))
+	})
+	mux.Handle("/metrics", metrics.Default.Handler())
+	return mux
+}
+
+// connectionState tracks whether the bot is connected to Slack.
+type connectionState struct {
+	mu        sync.Mutex
+	connected bool
+	since     time.Time
+}
+
+func (c *connectionState) Set(connected bool, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.connected != connected {
+		c.connected, c.since = connected, now
+	}
+	if connected {
+		slackConnected.Set(1)
+	} else {
+		slackConnected.Set(0)
+	}
+}
+
+// Check fails unless the bot is connected.
+func (c *connectionState) Check() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.connected {
+		return nil
+	}
+	if c.since.IsZero() {
+		return fmt.Errorf("not connected yet")
+	}
+	return fmt.Errorf("disconnected since %s", c.since.Format(time.RFC3339))
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "paperbot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store, err := NewStore(dir)
+	assert.NoError(t, err)
+
+	var connection connectionState
+	health := NewHealth()
+	health.AddCheck("slack", connection.Check)
+	health.AddCheck("store", store.Check)
+	handler := health.Handler()
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, get("/healthz").Code)
+	w := get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "slack: not connected yet\n", w.Body.String())
+
+	connection.Set(true, time.Now())
+	assert.Equal(t, http.StatusOK, get("/readyz").Code)
+
+	connection.Set(false, time.Date(2018, 11, 9, 12, 0, 0, 0, time.UTC))
+	os.RemoveAll(dir)
+	w = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "slack: disconnected since 2018-11-09T12:00:00Z\nstore: ")
+
+	w = get("/metrics")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "paperbot_slack_connected 0\n")
+}
+
+func TestSourceName(t *testing.T) {
+	assert.Equal(t, "arxiv", sourceName("https://arxiv.org/abs/1805.09547"))
+	assert.Equal(t, "aclweb", sourceName("http://aclweb.org/anthology/P18-1001"))
+	assert.Equal(t, "unknown", sourceName("https://example.com/paper"))
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// supportedLanguages lists the language codes users may choose, with the
+// title of the translated abstract field shown in attachments.
+var supportedLanguages = map[string]string{
+	"ja":    "概要",
+	"en":    "Abstract",
+	"ko":    "초록",
+	"zh-CN": "摘要",
+	"zh-TW": "摘要",
+}
+
+var languageAliases = map[string]string{
+	"zh":    "zh-CN",
+	"zh-cn": "zh-CN",
+	"zh-tw": "zh-TW",
+	"cn":    "zh-CN",
+	"tw":    "zh-TW",
+	"jp":    "ja",
+	"kr":    "ko",
+}
+
+// normalizeLanguage returns the canonical form of a language code typed by a
+// user and whether it is supported.
+func normalizeLanguage(code string) (string, bool) {
+	code = strings.TrimSpace(code)
+	if alias, ok := languageAliases[strings.ToLower(code)]; ok {
+		code = alias
+	} else {
+		code = strings.ToLower(code)
+	}
+	_, ok := supportedLanguages[code]
+	return code, ok
+}
+
+func abstractFieldTitle(lang string) string {
+	if title, ok := supportedLanguages[lang]; ok && lang != "en" {
+		return title
+	}
+	return fmt.Sprintf("Abstract (%s)", lang)
+}
+
+// ParseLanguagePairs parses pairs written as "ja:en,en:ja" into a map from
+// source to target language.
+func ParseLanguagePairs(s string) (map[string]string, error) {
+	pairs := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		split := strings.Split(pair, ":")
+		if len(split) != 2 {
+			return nil, fmt.Errorf("invalid language pair: %q", pair)
+		}
+		from, ok := normalizeLanguage(split[0])
+		if !ok {
+			return nil, fmt.Errorf("unsupported language: %q", split[0])
+		}
+		to, ok := normalizeLanguage(split[1])
+		if !ok {
+			return nil, fmt.Errorf("unsupported language: %q", split[1])
+		}
+		pairs[from] = to
+	}
+	return pairs, nil
+}
+
+// Languages decides which language to translate into. Defaults come from the
+// configured pairs; users and channels can override them with preferences
+// that are kept in the store.
+type Languages struct {
+	// Pairs maps a detected source language to its default target.
+	Pairs map[string]string
+	// Fallback is the target for sources without a pair.
+	Fallback string
+
+	store *Store
+	mu    sync.Mutex
+	prefs languagePrefs
+}
+
+type languagePrefs struct {
+	Channels map[string][]string
+	Users    map[string]string
+}
+
+func NewLanguages(store *Store, pairs map[string]string, fallback string) (*Languages, error) {
+	l := &Languages{
+		Pairs:    pairs,
+		Fallback: fallback,
+		store:    store,
+		prefs: languagePrefs{
+			Channels: map[string][]string{},
+			Users:    map[string]string{},
+		},
+	}
+	if err := store.Load("languages", &l.prefs); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Target returns the language a message from user in channel, written in
+// source, should be translated into.
+func (l *Languages) Target(source, user, channel string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if lang, ok := l.prefs.Users[user]; ok && lang != source {
+		return lang
+	}
+	for _, lang := range l.prefs.Channels[channel] {
+		if lang != source {
+			return lang
+		}
+	}
+	if lang, ok := l.Pairs[source]; ok {
+		return lang
+	}
+	return l.Fallback
+}
+
+// ChannelLanguages returns the languages abstracts are shown in for channel.
+func (l *Languages) ChannelLanguages(channel string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if langs, ok := l.prefs.Channels[channel]; ok {
+		return langs
+	}
+	return []string{l.Fallback}
+}
+
+// UserLanguage returns the preferred language of user, if any.
+func (l *Languages) UserLanguage(user string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lang, ok := l.prefs.Users[user]
+	return lang, ok
+}
+
+// SetUser sets the preferred language of user. An empty lang clears it.
+func (l *Languages) SetUser(user, lang string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if lang == "" {
+		delete(l.prefs.Users, user)
+	} else {
+		l.prefs.Users[user] = lang
+	}
+	return l.store.Save("languages", l.prefs)
+}
+
+// SetChannel sets the languages of channel. No langs clears them.
+func (l *Languages) SetChannel(channel string, langs []string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(langs) == 0 {
+		delete(l.prefs.Channels, channel)
+	} else {
+		l.prefs.Channels[channel] = langs
+	}
+	return l.store.Save("languages", l.prefs)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestParseLanguagePairs(t *testing.T) {
+	pairs, err := ParseLanguagePairs("ja:en, en:ja,ko:zh")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"ja": "en", "en": "ja", "ko": "zh-CN"}, pairs)
+
+	_, err = ParseLanguagePairs("ja-en")
+	assert.Error(t, err)
+	_, err = ParseLanguagePairs("ja:xx")
+	assert.Error(t, err)
+}
+
+func TestLanguagesTarget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "paperbot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store, err := NewStore(dir)
+	assert.NoError(t, err)
+
+	langs, err := NewLanguages(store, map[string]string{"ja": "en", "en": "ja"}, "ja")
+	assert.NoError(t, err)
+	assert.Equal(t, "en", langs.Target("ja", "U1", "C1"))
+	assert.Equal(t, "ja", langs.Target("en", "U1", "C1"))
+	assert.Equal(t, "ja", langs.Target("auto", "U1", "C1"))
+	assert.Equal(t, []string{"ja"}, langs.ChannelLanguages("C1"))
+
+	assert.NoError(t, langs.SetChannel("C1", []string{"ko", "ja"}))
+	assert.NoError(t, langs.SetUser("U2", "zh-CN"))
+	assert.Equal(t, "ko", langs.Target("en", "U1", "C1"))
+	assert.Equal(t, "ja", langs.Target("ko", "U1", "C1"))
+	assert.Equal(t, "zh-CN", langs.Target("en", "U2", "C1"))
+
+	// preferences survive a restart
+	langs, err = NewLanguages(store, map[string]string{}, "ja")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ko", "ja"}, langs.ChannelLanguages("C1"))
+	lang, ok := langs.UserLanguage("U2")
+	assert.True(t, ok)
+	assert.Equal(t, "zh-CN", lang)
+}
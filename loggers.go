@@ -0,0 +1,17 @@
+package main
+
+import "github.com/reiyw/paperbot/logging"
+
+// The loggers of the subsystems of the bot, whose levels are set apart with
+// LOG_LEVEL, e.g. "info,fetch=debug".
+var (
+	slackLog     = logging.New("slack")
+	fetchLog     = logging.New("fetch")
+	trendLog     = logging.New("trend")
+	outboxLog    = logging.New("outbox")
+	scheduleLog  = logging.New("schedule")
+	notifyLog    = logging.New("notify")
+	storeLog     = logging.New("store")
+	configLog    = logging.New("config")
+	lifecycleLog = logging.New("lifecycle")
+)
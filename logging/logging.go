@@ -0,0 +1,258 @@
+// Package logging writes leveled, structured log records as logfmt or JSON.
+//
+// Each subsystem of the bot has its own Logger, and its level can be set
+// apart from the others, e.g. to debug fetching without the noise of every
+// Slack event. Message text and tokens are redacted by default.
+package logging
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+	// LevelOff disables logging.
+	LevelOff
+)
+
+var levelNames = []string{"debug", "info", "warn", "error", "off"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelOff {
+		return "level(" + strconv.Itoa(int(l)) + ")"
+	}
+	return levelNames[l]
+}
+
+// ParseLevel parses a level name such as "debug" or "warn".
+func ParseLevel(s string) (Level, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "warning" {
+		return LevelWarn, nil
+	}
+	for i, name := range levelNames {
+		if name == s {
+			return Level(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level: %q", s)
+}
+
+// ParseLevels parses a default level and per-subsystem levels written as
+// "info,fetch=debug,slack=warn". The default level may be omitted.
+func ParseLevels(s string) (Level, map[string]Level, error) {
+	level := LevelInfo
+	levels := map[string]Level{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		l, err := ParseLevel(kv[len(kv)-1])
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(kv) == 1 {
+			level = l
+		} else {
+			levels[strings.ToLower(strings.TrimSpace(kv[0]))] = l
+		}
+	}
+	return level, levels, nil
+}
+
+const (
+	FormatLogfmt = "logfmt"
+	FormatJSON   = "json"
+)
+
+// Config sets how records are written.
+type Config struct {
+	// Format is FormatLogfmt or FormatJSON.
+	Format string
+	// Level is the level of subsystems not in Levels.
+	Level  Level
+	Levels map[string]Level
+	// Redact hides the values of sensitive keys such as "text" and
+	// anything that looks like a Slack token.
+	Redact bool
+}
+
+var (
+	mu     sync.Mutex
+	out    io.Writer = os.Stdout
+	config           = Config{Format: FormatLogfmt, Level: LevelInfo, Redact: true}
+	now              = time.Now
+)
+
+// Configure sets where and how records of every logger are written.
+func Configure(w io.Writer, c Config) {
+	mu.Lock()
+	defer mu.Unlock()
+	out, config = w, c
+}
+
+// Logger writes the records of a subsystem, with fields attached to all of
+// them.
+type Logger struct {
+	subsystem string
+	fields    []interface{}
+}
+
+func New(subsystem string) *Logger {
+	return &Logger{subsystem: subsystem}
+}
+
+// With returns a logger adding the key-value pairs kv to every record,
+// e.g. the request a record is about.
+func (l *Logger) With(kv ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(kv))
+	fields = append(append(fields, l.fields...), kv...)
+	return &Logger{subsystem: l.subsystem, fields: fields}
+}
+
+// Enabled reports whether records at level are written.
+func (l *Logger) Enabled(level Level) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return level >= l.level()
+}
+
+// level returns the level of the subsystem; mu must be held.
+func (l *Logger) level() Level {
+	if level, ok := config.Levels[l.subsystem]; ok {
+		return level
+	}
+	return config.Level
+}
+
+func (l *Logger) Debug(msg string, kv ...interface{}) { l.log(LevelDebug, msg, kv) }
+func (l *Logger) Info(msg string, kv ...interface{})  { l.log(LevelInfo, msg, kv) }
+func (l *Logger) Warn(msg string, kv ...interface{})  { l.log(LevelWarn, msg, kv) }
+func (l *Logger) Error(msg string, kv ...interface{}) { l.log(LevelError, msg, kv) }
+
+func (l *Logger) log(level Level, msg string, kv []interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
+	if level < l.level() {
+		return
+	}
+
+	fields := []interface{}{
+		"time", now().UTC().Format(time.RFC3339Nano),
+		"level", level.String(),
+		"subsystem", l.subsystem,
+		"msg", msg,
+	}
+	fields = append(append(fields, l.fields...), kv...)
+	if len(fields)%2 != 0 {
+		fields = append(fields, "(missing)")
+	}
+
+	var b bytes.Buffer
+	if config.Format == FormatJSON {
+		b.WriteByte('{')
+	}
+	for i := 0; i < len(fields); i += 2 {
+		key := fmt.Sprint(fields[i])
+		value := formatValue(fields[i+1])
+		if config.Redact {
+			value = redact(key, value)
+		}
+		if config.Format == FormatJSON {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeJSON(&b, key)
+			b.WriteByte(':')
+			writeJSON(&b, value)
+		} else {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(key)
+			b.WriteByte('=')
+			b.WriteString(quoteLogfmt(value))
+		}
+	}
+	if config.Format == FormatJSON {
+		b.WriteByte('}')
+	}
+	b.WriteByte('\n')
+	_, _ = out.Write(b.Bytes())
+}
+
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func writeJSON(b *bytes.Buffer, s string) {
+	data, _ := json.Marshal(s)
+	b.Write(data)
+}
+
+func quoteLogfmt(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\\\t\r\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// redactedKeys are the keys whose values are never written when redacting.
+var redactedKeys = map[string]bool{
+	"text":     true,
+	"query":    true,
+	"token":    true,
+	"password": true,
+}
+
+var (
+	slackToken = regexp.MustCompile(`\bxox[a-z]-[A-Za-z0-9-]+|\bxapp-[A-Za-z0-9-]+`)
+	// the text to translate is passed in the URL of the translation request
+	queryParam = regexp.MustCompile(`([?&]q=)[^&\s"]*`)
+)
+
+func redact(key, value string) string {
+	if redactedKeys[strings.ToLower(key)] {
+		return fmt.Sprintf("[redacted %d bytes]", len(value))
+	}
+	value = slackToken.ReplaceAllString(value, "[redacted token]")
+	return queryParam.ReplaceAllString(value, "${1}[redacted]")
+}
+
+// RequestId returns a random ID to tie the records of a request together.
+func RequestId() string {
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return strconv.FormatInt(now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func withOutput(t *testing.T, c Config) *bytes.Buffer {
+	var b bytes.Buffer
+	Configure(&b, c)
+	now = func() time.Time { return time.Date(2018, 11, 9, 12, 0, 0, 0, time.UTC) }
+	t.Cleanup(func() {
+		Configure(os.Stdout, Config{Format: FormatLogfmt, Level: LevelInfo, Redact: true})
+		now = time.Now
+	})
+	return &b
+}
+
+func TestLogfmt(t *testing.T) {
+	b := withOutput(t, Config{Format: FormatLogfmt, Level: LevelInfo})
+	log := New("fetch").With("request", "r1")
+	log.Info("fetched", "url", "https://arxiv.org/abs/1805.09547", "error", errors.New("not found here"))
+	log.Debug("not written")
+	assert.Equal(t, `time=2018-11-09T12:00:00Z level=info subsystem=fetch msg=fetched request=r1 url=https://arxiv.org/abs/1805.09547 error="not found here"`+"\n", b.String())
+}
+
+func TestJSON(t *testing.T) {
+	b := withOutput(t, Config{Format: FormatJSON, Level: LevelInfo})
+	New("slack").Warn("reconnecting", "attempt", 3)
+	var record map[string]string
+	assert.NoError(t, json.Unmarshal(b.Bytes(), &record))
+	assert.Equal(t, map[string]string{
+		"time":      "2018-11-09T12:00:00Z",
+		"level":     "warn",
+		"subsystem": "slack",
+		"msg":       "reconnecting",
+		"attempt":   "3",
+	}, record)
+}
+
+func TestSubsystemLevels(t *testing.T) {
+	level, levels, err := ParseLevels("warn, fetch=debug,slack=off")
+	assert.NoError(t, err)
+	assert.Equal(t, LevelWarn, level)
+	assert.Equal(t, map[string]Level{"fetch": LevelDebug, "slack": LevelOff}, levels)
+	_, _, err = ParseLevels("fetch=loud")
+	assert.Error(t, err)
+
+	b := withOutput(t, Config{Format: FormatLogfmt, Level: level, Levels: levels})
+	assert.True(t, New("fetch").Enabled(LevelDebug))
+	assert.False(t, New("trend").Enabled(LevelInfo))
+	New("slack").Error("dropped")
+	assert.Empty(t, b.String())
+}
+
+func TestRedact(t *testing.T) {
+	b := withOutput(t, Config{Format: FormatLogfmt, Level: LevelInfo, Redact: true})
+	New("translate").Error("failed",
+		"text", "my secret message",
+		"error", "Get https://translate.example.com/?sl=ja&q=secret&tl=en: timeout",
+		"token", "xoxb-123-abc")
+	New("slack").Info("connecting with xoxb-123-abc")
+	assert.Equal(t, `time=2018-11-09T12:00:00Z level=error subsystem=translate msg=failed text="[redacted 17 bytes]" error="Get https://translate.example.com/?sl=ja&q=[redacted]&tl=en: timeout" token="[redacted 12 bytes]"`+"\n"+
+		`time=2018-11-09T12:00:00Z level=info subsystem=slack msg="connecting with [redacted token]"`+"\n", b.String())
+
+	b = withOutput(t, Config{Format: FormatLogfmt, Level: LevelInfo})
+	New("slack").Info("message", "text", "hello")
+	assert.Contains(t, b.String(), "text=hello")
+}
@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	fetched := r.NewCounter("papers_fetched_total", "Papers fetched.", "source", "outcome")
+	connected := r.NewGauge("connected", "Whether connected.")
+	latency := r.NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1})
+	r.NewGaugeFunc("depth", "Messages waiting.", func() float64 { return 3 })
+	r.NewCounterFunc("sent_total", "Messages sent.", func() float64 { return 7 })
+
+	fetched.Inc("arxiv", "ok")
+	fetched.Add(2, "arxiv", "ok")
+	fetched.Inc("aclweb", `"odd"`)
+	connected.Set(1)
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	latency.Observe(5)
+
+	var b bytes.Buffer
+	assert.NoError(t, r.WriteText(&b))
+	assert.Equal(t, `# HELP papers_fetched_total Papers fetched.
+# TYPE papers_fetched_total counter
+papers_fetched_total{source="aclweb",outcome="\"odd\""} 1
+papers_fetched_total{source="arxiv",outcome="ok"} 3
+# HELP connected Whether connected.
+# TYPE connected gauge
+connected 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 5.55
+latency_seconds_count 3
+# HELP depth Messages waiting.
+# TYPE depth gauge
+depth 3
+# HELP sent_total Messages sent.
+# TYPE sent_total counter
+sent_total 7
+`, b.String())
+}
+
+func TestRegistryPanics(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("total", "Total.", "kind")
+	assert.Panics(t, func() { r.NewGauge("total", "Again.") })
+	assert.Panics(t, func() { c.Inc() })
+	assert.Panics(t, func() { c.Add(-1, "a") })
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("total", "Total.").Inc()
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "total 1\n")
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ArxivSubscription selects the new submissions a channel is alerted of.
+type ArxivSubscription struct {
+	Categories []string
+	// Include requires at least one keyword in the title or abstract.
+	Include []string `json:",omitempty"`
+	// Exclude drops papers with any keyword in the title or abstract.
+	Exclude []string `json:",omitempty"`
+}
+
+func (s ArxivSubscription) Matches(p Paper) bool {
+	text := strings.ToLower(p.Title + " " + p.AbstText)
+	if len(s.Include) > 0 && !containsAny(text, s.Include) {
+		return false
+	}
+	return !containsAny(text, s.Exclude)
+}
+
+func (s ArxivSubscription) String() string {
+	parts := []string{"categories: " + strings.Join(s.Categories, ", ")}
+	if len(s.Include) > 0 {
+		parts = append(parts, "include: "+strings.Join(quoteAll(s.Include), ", "))
+	}
+	if len(s.Exclude) > 0 {
+		parts = append(parts, "exclude: "+strings.Join(quoteAll(s.Exclude), ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// newSubmissionsLimit is the number of papers listed in one alert.
+const newSubmissionsLimit = 50
+
+// newSubmissionsRetention is how long posted papers are remembered, so that
+// a paper cross-listed on a later day is not posted again.
+const newSubmissionsRetention = 14 * 24 * time.Hour
+
+// newSubmissionPoster alerts subscribed channels of the submissions in each
+// new arXiv announcement. It can run at any time: categories whose latest
+// announcement was already processed are skipped.
+type newSubmissionPoster struct {
+	Listing  *ArxivListing
+	Settings *ChannelSettings
+	Store    *Store
+	Send     func(channel, text string)
+	// Subscribers, if set, are notified of every new submission they
+	// follow in the categories fetched.
+	Subscribers *UserSubscriptions
+
+	mu    sync.Mutex
+	state newSubmissionState
+}
+
+type newSubmissionState struct {
+	// Announced is the date of the latest announcement processed per
+	// category.
+	Announced map[string]time.Time
+	// Posted holds the IDs of papers posted to each channel and when.
+	Posted map[string]map[string]time.Time
+}
+
+func newNewSubmissionPoster(listing *ArxivListing, settings *ChannelSettings, store *Store, send func(channel, text string)) (*newSubmissionPoster, error) {
+	n := &newSubmissionPoster{
+		Listing:  listing,
+		Settings: settings,
+		Store:    store,
+		Send:     send,
+		state: newSubmissionState{
+			Announced: map[string]time.Time{},
+			Posted:    map[string]map[string]time.Time{},
+		},
+	}
+	if err := store.Load("new_submissions", &n.state); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// PostAll fetches the categories subscribed to and posts what is new.
+func (n *newSubmissionPoster) PostAll() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	subs := n.Settings.ArxivSubscriptions()
+	announcements := map[string]*Announcement{}
+	for _, sub := range subs {
+		for _, category := range sub.Categories {
+			if _, ok := announcements[category]; ok {
+				continue
+			}
+			a, err := n.Listing.Fetch(category)
+			if err != nil {
+				trendLog.Error("arXiv listing error", "category", category, "error", err)
+				continue
+			}
+			// no announcement today, or already processed
+			if len(a.Papers) == 0 || !a.Date.After(n.state.Announced[category]) {
+				continue
+			}
+			announcements[category] = a
+		}
+	}
+	if len(announcements) == 0 {
+		return
+	}
+	if n.Subscribers != nil {
+		for category, a := range announcements {
+			n.Subscribers.Match("new in "+category, a.Papers, "")
+		}
+	}
+
+	now := time.Now()
+	for channel, sub := range subs {
+		posted, ok := n.state.Posted[channel]
+		if !ok {
+			posted = map[string]time.Time{}
+			n.state.Posted[channel] = posted
+		}
+		var papers []Paper
+		var categories []string
+		for _, category := range sub.Categories {
+			a, ok := announcements[category]
+			if !ok {
+				continue
+			}
+			categories = append(categories, category)
+			for _, p := range a.Papers {
+				// a cross-listed paper appears in several categories
+				if _, ok := posted[p.Id]; ok || !sub.Matches(p) {
+					continue
+				}
+				posted[p.Id] = now
+				papers = append(papers, p)
+			}
+		}
+		if len(papers) > 0 {
+			n.Send(channel, formatNewSubmissions(categories, papers))
+		}
+		for id, t := range posted {
+			if now.Sub(t) > newSubmissionsRetention {
+				delete(posted, id)
+			}
+		}
+	}
+
+	for category, a := range announcements {
+		n.state.Announced[category] = a.Date
+	}
+	if err := n.Store.Save("new_submissions", n.state); err != nil {
+		storeLog.Error("store error", "error", err)
+	}
+}
+
+// formatNewSubmissions lists new submissions in one message.
+func formatNewSubmissions(categories []string, papers []Paper) string {
+	sort.Strings(categories)
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "*New in %s* (%s)", strings.Join(categories, ", "), countPapers(len(papers)))
+	for i, p := range papers {
+		if i == newSubmissionsLimit {
+			_, _ = fmt.Fprintf(&b, "\n…and %d more", len(papers)-newSubmissionsLimit)
+			break
+		}
+		_, _ = fmt.Fprintf(&b, "\n%d. %s", i+1, formatAsPlainPaperInfo(p))
+	}
+	return b.String()
+}
+
+// countPapers formats n as "1 paper" or "n papers".
+func countPapers(n int) string {
+	if n == 1 {
+		return "1 paper"
+	}
+	return fmt.Sprintf("%d papers", n)
+}
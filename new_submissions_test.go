@@ -0,0 +1,75 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestArxivListing(t *testing.T) {
+	server := httptest.NewServer(http.StripPrefix("/rss/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "testdata/arxiv_rss_"+r.URL.Path+".xml")
+	})))
+	defer server.Close()
+
+	listing := &ArxivListing{Url: server.URL + "/rss/"}
+	a, err := listing.Fetch("cs.CL")
+	assert.NoError(t, err)
+	assert.Equal(t, 2024, a.Date.Year())
+	assert.Len(t, a.Papers, 2)
+	p := a.Papers[0]
+	assert.Equal(t, "2410.05001", p.Id)
+	assert.Equal(t, "Knowledge Graph Completion with Relation Autoencoders", p.Title)
+	assert.Equal(t, []string{"Ryo Takahashi", "Ran Tian", "Kentaro Inui"}, p.Authors)
+	assert.Equal(t, "We study knowledge graph completion with autoencoders.", p.AbstText)
+	assert.Equal(t, []string{"cs.CL", "cs.LG"}, p.Categories)
+	assert.Equal(t, "https://arxiv.org/abs/2410.05001", p.AbstUrl)
+	assert.Equal(t, "2410.05002", a.Papers[1].Id)
+
+	a, err = listing.Fetch("stat.ML")
+	assert.NoError(t, err)
+	assert.Empty(t, a.Papers)
+}
+
+func TestNewSubmissionPoster(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "testdata/arxiv_rss_"+r.URL.Path[1:]+".xml")
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "paperbot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store, err := NewStore(dir)
+	assert.NoError(t, err)
+	settings, err := NewChannelSettings(store, TrendLayoutDigest, TrendModeNew)
+	assert.NoError(t, err)
+	assert.NoError(t, settings.SetArxivSubscription("C1", &ArxivSubscription{Categories: []string{"cs.CL", "cs.LG", "stat.ML"}}))
+	assert.NoError(t, settings.SetArxivSubscription("D1", &ArxivSubscription{Categories: []string{"cs.CL"}, Exclude: []string{"vision"}}))
+
+	sent := map[string]string{}
+	send := func(channel, text string) {
+		sent[channel] = text
+	}
+	poster, err := newNewSubmissionPoster(&ArxivListing{Url: server.URL + "/"}, settings, store, send)
+	assert.NoError(t, err)
+	poster.PostAll()
+
+	assert.Len(t, sent, 2)
+	// the paper cross-listed to cs.LG is posted once, and stat.ML has no announcement
+	assert.Contains(t, sent["C1"], "*New in cs.CL, cs.LG* (2 papers)")
+	assert.Contains(t, sent["C1"], "1. Ryo Takahashi, Ran Tian, Kentaro Inui. <https://arxiv.org/abs/2410.05001 |Knowledge Graph Completion")
+	assert.Contains(t, sent["C1"], "2. Jane Doe.")
+	assert.Contains(t, sent["D1"], "(1 paper)")
+	assert.NotContains(t, sent["D1"], "Jane Doe")
+
+	// the same announcement is not posted again, even after a restart
+	sent = map[string]string{}
+	poster, err = newNewSubmissionPoster(&ArxivListing{Url: server.URL + "/"}, settings, store, send)
+	assert.NoError(t, err)
+	poster.PostAll()
+	assert.Empty(t, sent)
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nlopes/slack"
+	"github.com/reiyw/paperbot/queue"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OutboxMessage is a message waiting to be posted.
+type OutboxMessage struct {
+	Id      int64
+	Channel string
+	Text    string
+	// ThreadTimestamp posts the message as a reply in a thread.
+	ThreadTimestamp string             `json:",omitempty"`
+	Attachments     []slack.Attachment `json:",omitempty"`
+	// Details asks for the details of the papers linked in the message to
+	// be posted in its thread once it is sent.
+	Details bool `json:",omitempty"`
+	// Reply messages answer a user and go ahead of other messages.
+	Reply bool `json:",omitempty"`
+
+	Attempts  int       `json:",omitempty"`
+	NotBefore time.Time `json:",omitempty"`
+	LastError string    `json:",omitempty"`
+}
+
+// OutboxStats describes the state of the outbox for monitoring.
+type OutboxStats struct {
+	// Depth is the number of messages waiting in each channel.
+	Depth       map[string]int
+	DeadLetters int
+	Sent        int64
+	Retries     int64
+}
+
+// Outbox posts messages in the background, one channel at a time no faster
+// than Interval, retrying failures with exponential backoff or as long as
+// Slack asks. Pending messages are kept in the store, so they are posted
+// after a restart; messages failing MaxAttempts times, or with an error that
+// retrying does not fix, are moved to the dead letters, from where they can
+// be retried by hand.
+type Outbox struct {
+	// Post sends m and returns the timestamp of the posted message.
+	Post func(m OutboxMessage) (string, error)
+	// OnSent, if set, is called after m is posted as timestamp.
+	OnSent func(m OutboxMessage, timestamp string)
+	// Interval is the minimum time between messages to a channel.
+	Interval    time.Duration
+	MaxAttempts int
+	Backoff     time.Duration
+
+	store    *Store
+	mu       sync.Mutex
+	channels map[string]*outboxChannel
+	// retrying holds the messages to be tried again, by when.
+	retrying *queue.DelayQueue[OutboxMessage]
+	// posting is the message handed out by next until it is done.
+	posting  *OutboxMessage
+	lastSent map[string]time.Time
+	state    outboxState
+	sent     int64
+	retries  int64
+	// wake is signalled when a message is enqueued.
+	wake chan struct{}
+}
+
+type outboxState struct {
+	Seq         int64
+	Pending     []OutboxMessage `json:",omitempty"`
+	DeadLetters []OutboxMessage `json:",omitempty"`
+}
+
+// outboxDeadLetters is how many dead letters are kept.
+const outboxDeadLetters = 100
+
+func NewOutbox(store *Store, post func(OutboxMessage) (string, error)) (*Outbox, error) {
+	o := &Outbox{
+		Post:        post,
+		Interval:    time.Second,
+		MaxAttempts: 5,
+		Backoff:     2 * time.Second,
+		store:       store,
+		channels:    map[string]*outboxChannel{},
+		retrying:    queue.NewDelay[OutboxMessage](),
+		lastSent:    map[string]time.Time{},
+		wake:        make(chan struct{}, 1),
+	}
+	if err := store.Load("outbox", &o.state); err != nil {
+		return nil, err
+	}
+	for _, m := range o.state.Pending {
+		if m.NotBefore.IsZero() {
+			o.channel(m.Channel).push(m)
+		} else {
+			o.retry(m)
+		}
+	}
+	return o, nil
+}
+
+// outboxChannel holds the messages waiting for a channel.
+type outboxChannel struct {
+	messages *queue.PriorityQueue[OutboxMessage]
+	// waiting is set while a message of the channel is to be retried, which
+	// the others wait for, so that they stay in order.
+	waiting bool
+}
+
+// outboxPriority orders the messages of a channel: replies go first, and
+// a message tried before goes ahead of the others of its kind.
+func outboxPriority(m OutboxMessage) int {
+	priority := 0
+	if m.Reply {
+		priority += 2
+	}
+	if m.Attempts > 0 {
+		priority++
+	}
+	return priority
+}
+
+func (c *outboxChannel) push(m OutboxMessage) {
+	_ = c.messages.Push(m, outboxPriority(m))
+}
+
+func (o *Outbox) channel(channel string) *outboxChannel {
+	c, ok := o.channels[channel]
+	if !ok {
+		c = &outboxChannel{messages: queue.NewPriority[OutboxMessage]()}
+		o.channels[channel] = c
+	}
+	return c
+}
+
+// Reply queues text answering a user to be posted to channel ahead of
+// other messages.
+func (o *Outbox) Reply(channel, text string) {
+	o.Enqueue(OutboxMessage{Channel: channel, Text: text, Reply: true})
+}
+
+// Send queues text to be posted to channel.
+func (o *Outbox) Send(channel, text string) {
+	o.Enqueue(OutboxMessage{Channel: channel, Text: text})
+}
+
+// SendWithDetails queues text to be posted to channel with the details of
+// the papers it links in its thread.
+func (o *Outbox) SendWithDetails(channel, text string) {
+	o.Enqueue(OutboxMessage{Channel: channel, Text: text, Details: true})
+}
+
+// Enqueue queues m to be posted.
+func (o *Outbox) Enqueue(m OutboxMessage) {
+	o.mu.Lock()
+	o.state.Seq++
+	m.Id = o.state.Seq
+	o.channel(m.Channel).push(m)
+	o.save()
+	o.mu.Unlock()
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run posts messages until ctx is done.
+func (o *Outbox) Run(ctx context.Context) {
+	o.run(ctx, false)
+}
+
+// Drain posts the pending messages until none are left or ctx is done, and
+// returns how many are left. Those are posted after a restart.
+func (o *Outbox) Drain(ctx context.Context) int {
+	o.run(ctx, true)
+	return o.pending()
+}
+
+func (o *Outbox) run(ctx context.Context, drain bool) {
+	for ctx.Err() == nil {
+		if drain && o.pending() == 0 {
+			return
+		}
+		m, wait, ok := o.next(time.Now())
+		if !ok {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-o.wake:
+			case <-timer.C:
+			}
+			timer.Stop()
+			continue
+		}
+		timestamp, err := o.Post(m)
+		o.done(m, err, time.Now())
+		if err == nil && o.OnSent != nil {
+			o.OnSent(m, timestamp)
+		}
+	}
+}
+
+// pending returns the number of messages waiting to be posted.
+func (o *Outbox) pending() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	n := 0
+	for _, depth := range o.depth() {
+		n += depth
+	}
+	return n
+}
+
+// depth returns the number of messages waiting for each channel; o.mu must
+// be held.
+func (o *Outbox) depth() map[string]int {
+	depth := map[string]int{}
+	for channel, c := range o.channels {
+		if n := c.messages.Len(); n > 0 {
+			depth[channel] += n
+		}
+	}
+	o.retrying.Range(func(m OutboxMessage, _ time.Time) bool {
+		depth[m.Channel]++
+		return true
+	})
+	if o.posting != nil {
+		depth[o.posting.Channel]++
+	}
+	return depth
+}
+
+// next takes the message to post at now, or returns how long to wait for
+// one. Channels are served replies first, then oldest message first.
+func (o *Outbox) next(now time.Time) (OutboxMessage, time.Duration, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	// the retries due go back to the front of their channels
+	for {
+		m, at, ok := o.retrying.Front()
+		if !ok || at.After(now) {
+			break
+		}
+		if _, ok := o.retrying.TryPop(); !ok {
+			break
+		}
+		m.NotBefore = time.Time{}
+		c := o.channel(m.Channel)
+		c.waiting = false
+		c.push(m)
+	}
+
+	var ready OutboxMessage
+	found := false
+	wait := time.Hour
+	o.retrying.Range(func(m OutboxMessage, at time.Time) bool {
+		if sendable := o.lastSent[m.Channel].Add(o.Interval); sendable.After(at) {
+			at = sendable
+		}
+		if d := at.Sub(now); d < wait {
+			wait = d
+		}
+		return true
+	})
+	for channel, c := range o.channels {
+		if c.waiting {
+			continue
+		}
+		m, ok := c.messages.Front()
+		if !ok {
+			continue
+		}
+		if d := o.lastSent[channel].Add(o.Interval).Sub(now); d > 0 {
+			if d < wait {
+				wait = d
+			}
+			continue
+		}
+		if !found || m.Reply && !ready.Reply || m.Reply == ready.Reply && m.Id < ready.Id {
+			ready, found = m, true
+		}
+	}
+	if !found {
+		return OutboxMessage{}, wait, false
+	}
+	o.channels[ready.Channel].messages.TryPop()
+	// the message stays in the store until it is done
+	o.posting = &ready
+	return ready, 0, true
+}
+
+// done removes m, taken by next, from the outbox if it was posted, and
+// otherwise schedules a retry or moves it to the dead letters.
+func (o *Outbox) done(m OutboxMessage, err error, now time.Time) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.posting = nil
+	o.lastSent[m.Channel] = now
+	if err == nil {
+		o.sent++
+		o.save()
+		return
+	}
+
+	m.Attempts++
+	m.LastError = err.Error()
+	if m.Attempts >= o.MaxAttempts || !retryable(err) {
+		outboxLog.Error("giving up on message", "id", m.Id, "channel", m.Channel, "attempts", m.Attempts, "error", err)
+		o.state.DeadLetters = append(o.state.DeadLetters, m)
+		if len(o.state.DeadLetters) > outboxDeadLetters {
+			o.state.DeadLetters = o.state.DeadLetters[len(o.state.DeadLetters)-outboxDeadLetters:]
+		}
+		o.save()
+		return
+	}
+	delay := o.Backoff << uint(m.Attempts-1)
+	if rateLimited, ok := err.(*slack.RateLimitedError); ok {
+		delay = rateLimited.RetryAfter
+	}
+	outboxLog.Warn("retrying message", "id", m.Id, "channel", m.Channel, "delay", delay, "error", err)
+	o.retries++
+	m.NotBefore = now.Add(delay)
+	o.retry(m)
+	o.save()
+}
+
+// retry holds m and the other messages of its channel until m.NotBefore;
+// o.mu must be held.
+func (o *Outbox) retry(m OutboxMessage) {
+	_ = o.retrying.Push(m, m.NotBefore)
+	o.channel(m.Channel).waiting = true
+}
+
+// retryable reports whether posting may succeed when tried again: Slack is
+// rate limiting, failing on its side or not reachable. Errors such as
+// channel_not_found, not_in_channel or invalid_auth stay until fixed by hand.
+func retryable(err error) bool {
+	// rate limits and HTTP status errors tell themselves
+	var r interface{ Retryable() bool }
+	if errors.As(err, &r) {
+		return r.Retryable()
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	switch err.Error() {
+	case "internal_error", "fatal_error", "service_unavailable", "request_timeout":
+		return true
+	}
+	return false
+}
+
+// save writes the pending messages to the store; o.mu must be held.
+func (o *Outbox) save() {
+	o.state.Pending = o.state.Pending[:0]
+	if o.posting != nil {
+		o.state.Pending = append(o.state.Pending, *o.posting)
+	}
+	for _, c := range o.channels {
+		c.messages.Range(func(m OutboxMessage, _ int) bool {
+			o.state.Pending = append(o.state.Pending, m)
+			return true
+		})
+	}
+	o.retrying.Range(func(m OutboxMessage, _ time.Time) bool {
+		o.state.Pending = append(o.state.Pending, m)
+		return true
+	})
+	sort.Slice(o.state.Pending, func(i, j int) bool {
+		return o.state.Pending[i].Id < o.state.Pending[j].Id
+	})
+	if err := o.store.Save("outbox", o.state); err != nil {
+		storeLog.Error("store error", "error", err)
+	}
+}
+
+// RetryDeadLetters queues the dead letters again and returns how many there
+// were.
+func (o *Outbox) RetryDeadLetters() int {
+	o.mu.Lock()
+	letters := o.state.DeadLetters
+	o.state.DeadLetters = nil
+	o.mu.Unlock()
+
+	for _, m := range letters {
+		m.Attempts, m.NotBefore, m.LastError = 0, time.Time{}, ""
+		o.Enqueue(m)
+	}
+	return len(letters)
+}
+
+// DeadLetters returns the messages given up on, oldest first.
+func (o *Outbox) DeadLetters() []OutboxMessage {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return append([]OutboxMessage(nil), o.state.DeadLetters...)
+}
+
+func (o *Outbox) Stats() OutboxStats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return OutboxStats{
+		Depth:       o.depth(),
+		DeadLetters: len(o.state.DeadLetters),
+		Sent:        o.sent,
+		Retries:     o.retries,
+	}
+}
+
+// formatOutboxStats summarizes the outbox for the outbox command.
+func formatOutboxStats(stats OutboxStats, deadLetters []OutboxMessage) string {
+	pending := 0
+	var channels []string
+	for channel, n := range stats.Depth {
+		pending += n
+		channels = append(channels, fmt.Sprintf("<#%s> %d", channel, n))
+	}
+	sort.Strings(channels)
+	s := fmt.Sprintf("Outbox: %d pending", pending)
+	if len(channels) > 0 {
+		s += " (" + strings.Join(channels, ", ") + ")"
+	}
+	s += fmt.Sprintf(", %d sent, %d retries, %d dead letters", stats.Sent, stats.Retries, stats.DeadLetters)
+	for _, m := range deadLetters {
+		s += fmt.Sprintf("\n• #%d to <#%s> after %d attempts: %s", m.Id, m.Channel, m.Attempts, m.LastError)
+	}
+	return s
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/nlopes/slack"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestOutbox(t *testing.T) {
+	dir, err := ioutil.TempDir("", "paperbot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store, err := NewStore(dir)
+	assert.NoError(t, err)
+
+	outbox, err := NewOutbox(store, nil)
+	assert.NoError(t, err)
+	outbox.Send("C1", "one")
+	outbox.Send("C1", "two")
+	outbox.SendWithDetails("C2", "three")
+	assert.Equal(t, map[string]int{"C1": 2, "C2": 1}, outbox.Stats().Depth)
+
+	// pending messages survive a restart
+	outbox, err = NewOutbox(store, nil)
+	assert.NoError(t, err)
+	outbox.Interval = 10 * time.Second
+	outbox.Backoff = time.Second
+	outbox.MaxAttempts = 3
+
+	now := time.Date(2018, 11, 9, 12, 0, 0, 0, time.UTC)
+	m, _, ok := outbox.next(now)
+	assert.True(t, ok)
+	assert.Equal(t, "one", m.Text)
+	outbox.done(m, nil, now)
+
+	// C1 is rate limited, so C2 goes next
+	m, _, ok = outbox.next(now)
+	assert.True(t, ok)
+	assert.Equal(t, "three", m.Text)
+	assert.True(t, m.Details)
+	outbox.done(m, &slack.RateLimitedError{RetryAfter: 30 * time.Second}, now)
+
+	_, wait, ok := outbox.next(now)
+	assert.False(t, ok)
+	assert.Equal(t, 10*time.Second, wait)
+	m, _, ok = outbox.next(now.Add(10 * time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, "two", m.Text)
+	outbox.done(m, nil, now.Add(10*time.Second))
+
+	// Slack's Retry-After is honoured
+	_, wait, ok = outbox.next(now.Add(20 * time.Second))
+	assert.False(t, ok)
+	assert.Equal(t, 10*time.Second, wait)
+	m, _, ok = outbox.next(now.Add(30 * time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, "three", m.Text)
+	assert.Equal(t, 1, m.Attempts)
+	outbox.done(m, errors.New("internal_error"), now.Add(30*time.Second))
+
+	// the backoff is shorter than the channel's interval
+	_, wait, ok = outbox.next(now.Add(31 * time.Second))
+	assert.False(t, ok)
+	assert.Equal(t, 9*time.Second, wait)
+	m, _, ok = outbox.next(now.Add(40 * time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, "three", m.Text)
+	outbox.done(m, errors.New("internal_error"), now.Add(40*time.Second))
+
+	_, _, ok = outbox.next(now.Add(time.Hour))
+	assert.False(t, ok)
+	stats := outbox.Stats()
+	assert.Equal(t, OutboxStats{Depth: map[string]int{}, DeadLetters: 1, Sent: 2, Retries: 2}, stats)
+	assert.Equal(t, "Outbox: 0 pending, 2 sent, 2 retries, 1 dead letters\n"+
+		"• #3 to <#C2> after 3 attempts: internal_error", formatOutboxStats(stats, outbox.DeadLetters()))
+
+	assert.Equal(t, 1, outbox.RetryDeadLetters())
+	assert.Equal(t, map[string]int{"C2": 1}, outbox.Stats().Depth)
+	m, _, ok = outbox.next(now.Add(time.Hour))
+	assert.True(t, ok)
+	assert.Equal(t, 0, m.Attempts)
+}
+
+func TestOutboxPermanentError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "paperbot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store, err := NewStore(dir)
+	assert.NoError(t, err)
+
+	outbox, err := NewOutbox(store, nil)
+	assert.NoError(t, err)
+	outbox.Send("C1", "one")
+	now := time.Now()
+	m, _, ok := outbox.next(now)
+	assert.True(t, ok)
+	// retrying does not bring the channel back
+	outbox.done(m, errors.New("channel_not_found"), now)
+	_, _, ok = outbox.next(now.Add(time.Hour))
+	assert.False(t, ok)
+	assert.Equal(t, OutboxStats{Depth: map[string]int{}, DeadLetters: 1}, outbox.Stats())
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err       error
+		retryable bool
+	}{
+		{&slack.RateLimitedError{RetryAfter: time.Second}, true},
+		{&url.Error{Op: "Post", URL: "https://slack.com/api/chat.postMessage", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}, true},
+		{errors.New("internal_error"), true},
+		{errors.New("channel_not_found"), false},
+		{errors.New("not_in_channel"), false},
+		{errors.New("invalid_auth"), false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.retryable, retryable(test.err), "%v", test.err)
+	}
+}
+
+func TestOutboxRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "paperbot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store, err := NewStore(dir)
+	assert.NoError(t, err)
+
+	posted := make(chan string, 10)
+	outbox, err := NewOutbox(store, func(m OutboxMessage) (string, error) {
+		posted <- m.Channel + ":" + m.Text
+		return "1541764800.000100", nil
+	})
+	assert.NoError(t, err)
+	outbox.Interval = 0
+	sent := make(chan string, 10)
+	outbox.OnSent = func(m OutboxMessage, timestamp string) {
+		sent <- timestamp
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		outbox.Run(ctx)
+		close(done)
+	}()
+
+	outbox.Send("C1", "hello")
+	select {
+	case p := <-posted:
+		assert.Equal(t, "C1:hello", p)
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not posted")
+	}
+	assert.Equal(t, "1541764800.000100", <-sent)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not stop")
+	}
+}
+
+func TestOutboxReplies(t *testing.T) {
+	dir, err := ioutil.TempDir("", "paperbot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store, err := NewStore(dir)
+	assert.NoError(t, err)
+
+	outbox, err := NewOutbox(store, nil)
+	assert.NoError(t, err)
+	outbox.Interval = 0
+	outbox.Send("C1", "digest 1")
+	outbox.Send("C2", "digest 2")
+	outbox.Send("C1", "digest 3")
+	outbox.Reply("C1", "reply 1")
+	outbox.Reply("C2", "reply 2")
+
+	// replies survive a restart ahead of the digests
+	outbox, err = NewOutbox(store, nil)
+	assert.NoError(t, err)
+	outbox.Interval = 0
+	now := time.Now()
+	var posted []string
+	for {
+		m, _, ok := outbox.next(now)
+		if !ok {
+			break
+		}
+		posted = append(posted, m.Text)
+		outbox.done(m, nil, now)
+	}
+	assert.Equal(t, []string{"reply 1", "reply 2", "digest 1", "digest 2", "digest 3"}, posted)
+}
+
+func TestOutboxDrain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "paperbot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store, err := NewStore(dir)
+	assert.NoError(t, err)
+
+	var posted []string
+	outbox, err := NewOutbox(store, func(m OutboxMessage) (string, error) {
+		if m.Channel == "C2" {
+			return "", errors.New("internal_error")
+		}
+		posted = append(posted, m.Text)
+		return "1541764800.000100", nil
+	})
+	assert.NoError(t, err)
+	outbox.Interval = 0
+	outbox.Send("C1", "one")
+	outbox.Send("C1", "two")
+	assert.Equal(t, 0, outbox.Drain(context.Background()))
+	assert.Equal(t, []string{"one", "two"}, posted)
+
+	// messages that cannot be posted before the deadline are kept
+	outbox.Backoff = time.Hour
+	outbox.Send("C2", "three")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, 1, outbox.Drain(ctx))
+	outbox, err = NewOutbox(store, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"C2": 1}, outbox.Stats().Depth)
+}
@@ -4,9 +4,8 @@ import (
 	"fmt"
 	"github.com/PuerkitoBio/goquery"
 	"github.com/araddon/dateparse"
-	"log"
-	"net/http"
 	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 )
@@ -25,6 +24,8 @@ type Paper struct {
 	BibText  string
 	BibUrl   string
 	Comment  string
+	// Categories are arXiv subject classes such as "cs.CL", primary first.
+	Categories []string
 	Preserver
 }
 
@@ -46,25 +47,22 @@ func Request(url string) (*Paper, error) {
 }
 
 func FromArxivId(id string) (*Paper, error) {
+	paper, _, err := fetchArxiv(id, pageValidators{})
+	return paper, err
+}
+
+func fetchArxiv(id string, validators pageValidators) (*Paper, pageValidators, error) {
 	var paper Paper
 	paper.Id = id
 	paper.AbstUrl = fmt.Sprintf("https://arxiv.org/abs/%s", paper.Id)
 	paper.PdfUrl = fmt.Sprintf("https://arxiv.org/pdf/%s.pdf", paper.Id)
 	paper.HtmlUrl = fmt.Sprintf("https://www.arxiv-vanity.com/papers/%s/", paper.Id)
 
-	res, err := http.Get(paper.AbstUrl)
+	// errors are returned rather than fatal, since papers are fetched
+	// concurrently on behalf of many conversations
+	doc, validators, err := getDocument(paper.AbstUrl, validators)
 	if err != nil {
-		log.Fatal(err)
-		return nil, err
-	}
-	if res.StatusCode != 200 {
-		log.Fatalf("status code error: %d %s", res.StatusCode, res.Status)
-		return nil, err
-	}
-	doc, err := goquery.NewDocumentFromReader(res.Body)
-	if err != nil {
-		log.Fatal(err)
-		return nil, err
+		return nil, validators, err
 	}
 
 	paper.Title, _ = doc.Find(`meta[name="citation_title"]`).Attr("content")
@@ -89,50 +87,48 @@ func FromArxivId(id string) (*Paper, error) {
 	comment = strings.Replace(comment, "\n", " ", -1)
 	paper.Comment = strings.TrimSpace(comment)
 
-	paper.Preserver = Arxiv
-
-	err = res.Body.Close()
-	if err != nil {
-		log.Fatal(err)
-		return nil, err
+	// "Computation and Language (cs.CL); Machine Learning (cs.LG)"
+	for _, m := range arxivCategory.FindAllStringSubmatch(doc.Find(".subjects").Text(), -1) {
+		paper.Categories = append(paper.Categories, m[1])
 	}
-	return &paper, nil
 
+	paper.Preserver = Arxiv
+
+	return &paper, validators, nil
 }
 
 func FromArxivUrl(rawurl string) (*Paper, error) {
+	return FromArxivId(arxivIdFromUrl(rawurl))
+}
+
+func arxivIdFromUrl(rawurl string) string {
 	// https://arxiv.org/pdf/1811.01458v1.pdf
 	//                    id ^^^^^^^^^^^^
-	split := strings.Split(rawurl, "/")
-	id := strings.Split(split[len(split)-1], ".pdf")[0]
-	return FromArxivId(id)
+	split := strings.Split(strings.Split(rawurl, "?")[0], "/")
+	return strings.Split(split[len(split)-1], ".pdf")[0]
+}
+
+// unversionedArxivId is the ID of the arXiv paper at rawurl without its
+// version, under which the paper is fetched and kept.
+func unversionedArxivId(rawurl string) string {
+	return arxivVersion.ReplaceAllString(arxivIdFromUrl(rawurl), "")
 }
 
 func FromAclweb(rawurl string) (*Paper, error) {
-	// https://aclweb.org/anthology/D16-1112.pdf
-	//                           id ^^^^^^^^
+	paper, _, err := fetchAclweb(rawurl, pageValidators{})
+	return paper, err
+}
+
+func fetchAclweb(rawurl string, validators pageValidators) (*Paper, pageValidators, error) {
 	var paper Paper
-	split := strings.Split(rawurl, "/")
-	id := strings.Split(split[len(split)-1], ".pdf")[0]
-	id = strings.Split(id, ".bib")[0]
-	paper.Id = strings.ToUpper(id)
+	paper.Id = aclIdFromUrl(rawurl)
 	paper.AbstUrl = fmt.Sprintf("https://aclanthology.info/papers/%s/%s", paper.Id, strings.ToLower(paper.Id))
 	paper.PdfUrl = fmt.Sprintf("http://aclweb.org/anthology/%s", paper.Id)
 	paper.BibUrl = fmt.Sprintf("http://aclweb.org/anthology/%s.bib", paper.Id)
 
-	res, err := http.Get(paper.AbstUrl)
-	if err != nil {
-		log.Fatal(err)
-		return nil, err
-	}
-	if res.StatusCode != 200 {
-		log.Fatalf("status code error: %d %s", res.StatusCode, res.Status)
-		return nil, err
-	}
-	doc, err := goquery.NewDocumentFromReader(res.Body)
+	doc, validators, err := getDocument(paper.AbstUrl, validators)
 	if err != nil {
-		log.Fatal(err)
-		return nil, err
+		return nil, validators, err
 	}
 
 	paper.Title, _ = doc.Find(`meta[name="citation_title"]`).Attr("content")
@@ -147,19 +143,53 @@ func FromAclweb(rawurl string) (*Paper, error) {
 	paper.Venue = aclPrefixToVenue(paper.Id[0:1])
 
 	yearStr, _ := doc.Find(`meta[name="citation_publication_date"]`).Attr("content")
-	year, _ := strconv.ParseInt(yearStr[0:4], 10, 32)
-	paper.Year = int(year)
+	if len(yearStr) >= 4 {
+		year, _ := strconv.ParseInt(yearStr[0:4], 10, 32)
+		paper.Year = int(year)
+	}
 
 	paper.Preserver = Aclweb
 
-	err = res.Body.Close()
+	return &paper, validators, nil
+}
+
+func aclIdFromUrl(rawurl string) string {
+	// https://aclweb.org/anthology/D16-1112.pdf
+	//                           id ^^^^^^^^
+	split := strings.Split(strings.TrimSuffix(rawurl, "/"), "/")
+	id := strings.Split(split[len(split)-1], ".pdf")[0]
+	id = strings.Split(id, ".bib")[0]
+	return strings.ToUpper(id)
+}
+
+// CanonicalId returns an identifier that is the same for every URL of a
+// paper, e.g. "arxiv:1805.09547" for both its abstract and versioned PDF.
+func CanonicalId(rawurl string) (string, error) {
+	preserver, err := DetectPreserver(rawurl)
 	if err != nil {
-		log.Fatal(err)
-		return nil, err
+		return "", err
+	}
+	switch preserver {
+	case Arxiv:
+		return "arxiv:" + unversionedArxivId(rawurl), nil
+	case Aclweb:
+		return "acl:" + aclIdFromUrl(rawurl), nil
+	case OpenReview:
+		parsed, _ := url.Parse(rawurl)
+		id := parsed.Query().Get("id")
+		if id == "" {
+			return "", fmt.Errorf("no paper id in URL: %s", rawurl)
+		}
+		return "openreview:" + id, nil
+	default:
+		return "", fmt.Errorf("notimplemented")
 	}
-	return &paper, nil
 }
 
+var arxivVersion = regexp.MustCompile(`v\d+$`)
+
+var arxivCategory = regexp.MustCompile(`\(([a-z\-]+(?:\.[A-Za-z\-]+)?)\)`)
+
 func aclPrefixToVenue(prefix string) string {
 	switch prefix {
 	case "J":
@@ -196,7 +226,10 @@ const (
 )
 
 func DetectPreserver(rawurl string) (Preserver, error) {
-	parsed, _ := url.Parse(rawurl)
+	parsed, err := url.Parse(rawurl)
+	if err != nil {
+		return -1, fmt.Errorf("given URL is not supported: %s", rawurl)
+	}
 	switch parsed.Hostname() {
 	case "arxiv.org":
 		return Arxiv, nil
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// pageValidators are the validators of a fetched page, sent back to ask
+// whether it changed since.
+type pageValidators struct {
+	ETag         string `json:",omitempty"`
+	LastModified string `json:",omitempty"`
+}
+
+// errNotModified is returned when a page did not change since it was
+// fetched with the validators given.
+var errNotModified = errors.New("not modified")
+
+// PageStatusError is returned for pages answered with an unexpected status.
+type PageStatusError struct {
+	Url        string
+	StatusCode int
+}
+
+func (e *PageStatusError) Error() string {
+	return fmt.Sprintf("status code error: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Url)
+}
+
+// getDocument fetches and parses the page at rawurl, unless it did not
+// change since it was fetched with validators.
+func getDocument(rawurl string, validators pageValidators) (*goquery.Document, pageValidators, error) {
+	req, err := http.NewRequest("GET", rawurl, nil)
+	if err != nil {
+		return nil, validators, err
+	}
+	if validators.ETag != "" {
+		req.Header.Set("If-None-Match", validators.ETag)
+	}
+	if validators.LastModified != "" {
+		req.Header.Set("If-Modified-Since", validators.LastModified)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, validators, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotModified {
+		return nil, validators, errNotModified
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, validators, &PageStatusError{Url: rawurl, StatusCode: res.StatusCode}
+	}
+	doc, err := goquery.NewDocumentFromReader(res.Body)
+	if err != nil {
+		return nil, validators, err
+	}
+	return doc, pageValidators{ETag: res.Header.Get("ETag"), LastModified: res.Header.Get("Last-Modified")}, nil
+}
+
+// fetchPaper is Request revalidating a page fetched before with validators.
+func fetchPaper(rawurl string, validators pageValidators) (*Paper, pageValidators, error) {
+	preserver, err := DetectPreserver(rawurl)
+	if err != nil {
+		return nil, validators, err
+	}
+	switch preserver {
+	case Arxiv:
+		// the latest version is fetched, as the cache keeps one per paper
+		return fetchArxiv(unversionedArxivId(rawurl), validators)
+	case Aclweb:
+		return fetchAclweb(rawurl, validators)
+	default:
+		paper, err := Request(rawurl)
+		return paper, pageValidators{}, err
+	}
+}
+
+// paperCacheRetention is how long a paper not requested is kept.
+const paperCacheRetention = 30 * 24 * time.Hour
+
+// PaperCache keeps the metadata of papers by canonical ID, so that a paper
+// shared, posted and trending is fetched once. Expired papers are
+// revalidated with their ETag or Last-Modified date, and papers not found
+// are remembered for NegativeTTL. The cache is kept in the store.
+type PaperCache struct {
+	TTL         time.Duration
+	NegativeTTL time.Duration
+
+	store   *Store
+	fetch   func(rawurl string, validators pageValidators) (*Paper, pageValidators, error)
+	now     func() time.Time
+	mu      sync.Mutex
+	entries map[string]*paperCacheEntry
+}
+
+type paperCacheEntry struct {
+	Paper *Paper `json:",omitempty"`
+	// NotFound is set if the page of the paper was missing.
+	NotFound   bool `json:",omitempty"`
+	Validators pageValidators
+	FetchedAt  time.Time
+	UsedAt     time.Time
+}
+
+func NewPaperCache(store *Store, ttl, negativeTTL time.Duration) (*PaperCache, error) {
+	c := &PaperCache{
+		TTL:         ttl,
+		NegativeTTL: negativeTTL,
+		store:       store,
+		fetch:       fetchPaper,
+		now:         time.Now,
+		entries:     map[string]*paperCacheEntry{},
+	}
+	if err := store.Load("papers", &c.entries); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SetTTL changes how long papers and papers not found are cached.
+func (c *PaperCache) SetTTL(ttl, negativeTTL time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.TTL, c.NegativeTTL = ttl, negativeTTL
+}
+
+// Request returns the paper at rawurl, from the cache if it is fresh.
+func (c *PaperCache) Request(rawurl string) (*Paper, error) {
+	return c.get(rawurl, false)
+}
+
+// Refresh fetches the paper at rawurl again, ignoring the cache.
+func (c *PaperCache) Refresh(rawurl string) (*Paper, error) {
+	return c.get(rawurl, true)
+}
+
+func (c *PaperCache) get(rawurl string, force bool) (*Paper, error) {
+	key, err := CanonicalId(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	now := c.now()
+	source := sourceName(rawurl)
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	var validators pageValidators
+	if ok && !force {
+		entry.UsedAt = now
+		switch {
+		case entry.NotFound && now.Sub(entry.FetchedAt) < c.NegativeTTL:
+			c.mu.Unlock()
+			papersFetched.Inc(source, "not_found")
+			return nil, fmt.Errorf("paper not found: %s", rawurl)
+		case !entry.NotFound && now.Sub(entry.FetchedAt) < c.TTL:
+			paper := *entry.Paper
+			c.mu.Unlock()
+			papersFetched.Inc(source, "cached")
+			return &paper, nil
+		case !entry.NotFound:
+			validators = entry.Validators
+		}
+	}
+	c.mu.Unlock()
+
+	paper, validators, err := c.fetch(rawurl, validators)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch statusErr, _ := err.(*PageStatusError); {
+	case err == errNotModified:
+		// the entry may have been refreshed or evicted meanwhile
+		if entry, ok = c.entries[key]; !ok || entry.Paper == nil {
+			return nil, fmt.Errorf("paper evicted while revalidating: %s", rawurl)
+		}
+		entry.FetchedAt = now
+		paper = entry.Paper
+		papersFetched.Inc(source, "revalidated")
+	case statusErr != nil && (statusErr.StatusCode == http.StatusNotFound || statusErr.StatusCode == http.StatusGone):
+		c.entries[key] = &paperCacheEntry{NotFound: true, FetchedAt: now, UsedAt: now}
+		c.save(now)
+		papersFetched.Inc(source, "not_found")
+		return nil, err
+	case err != nil:
+		// other failures are likely transient and not cached, and a stale
+		// paper is better than none, unless a fresh one was asked for
+		if entry, ok = c.entries[key]; ok && entry.Paper != nil && !force {
+			fetchLog.Warn("serving stale paper", "paper", key, "error", err)
+			papersFetched.Inc(source, "stale")
+			paper := *entry.Paper
+			return &paper, nil
+		}
+		papersFetched.Inc(source, "error")
+		return nil, err
+	default:
+		c.entries[key] = &paperCacheEntry{Paper: paper, Validators: validators, FetchedAt: now, UsedAt: now}
+		papersFetched.Inc(source, "fetched")
+	}
+	c.save(now)
+	copied := *paper
+	return &copied, nil
+}
+
+// save evicts papers not used for long and writes the cache to the store;
+// c.mu must be held.
+func (c *PaperCache) save(now time.Time) {
+	for key, entry := range c.entries {
+		if now.Sub(entry.UsedAt) > paperCacheRetention {
+			delete(c.entries, key)
+		}
+	}
+	if err := c.store.Save("papers", c.entries); err != nil {
+		storeLog.Error("store error", "error", err)
+	}
+}
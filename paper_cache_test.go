@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestGetDocument(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, `<meta name="citation_title" content="A Paper">`)
+	}))
+	defer server.Close()
+
+	doc, validators, err := getDocument(server.URL+"/paper", pageValidators{})
+	assert.NoError(t, err)
+	title, _ := doc.Find(`meta[name="citation_title"]`).Attr("content")
+	assert.Equal(t, "A Paper", title)
+	assert.Equal(t, `"v1"`, validators.ETag)
+
+	_, _, err = getDocument(server.URL+"/paper", validators)
+	assert.Equal(t, errNotModified, err)
+
+	_, _, err = getDocument(server.URL+"/missing", pageValidators{})
+	statusErr, ok := err.(*PageStatusError)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusNotFound, statusErr.StatusCode)
+}
+
+func TestPaperCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "paperbot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store, err := NewStore(dir)
+	assert.NoError(t, err)
+
+	cache, err := NewPaperCache(store, time.Hour, time.Minute)
+	assert.NoError(t, err)
+	now := time.Date(2018, 11, 9, 12, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+
+	var calls []pageValidators
+	var fetchErr error
+	cache.fetch = func(rawurl string, validators pageValidators) (*Paper, pageValidators, error) {
+		calls = append(calls, validators)
+		if fetchErr != nil {
+			return nil, validators, fetchErr
+		}
+		if validators.ETag == `"v1"` {
+			return nil, validators, errNotModified
+		}
+		return &Paper{Title: "A Paper"}, pageValidators{ETag: `"v1"`}, nil
+	}
+
+	paper, err := cache.Request("https://arxiv.org/abs/1805.09547")
+	assert.NoError(t, err)
+	assert.Equal(t, "A Paper", paper.Title)
+
+	// the PDF of a fresh paper is not fetched
+	_, err = cache.Request("https://arxiv.org/pdf/1805.09547v2.pdf")
+	assert.NoError(t, err)
+	assert.Len(t, calls, 1)
+
+	// an expired paper is revalidated
+	now = now.Add(2 * time.Hour)
+	paper, err = cache.Request("https://arxiv.org/abs/1805.09547")
+	assert.NoError(t, err)
+	assert.Equal(t, "A Paper", paper.Title)
+	assert.Equal(t, []pageValidators{{}, {ETag: `"v1"`}}, calls)
+	_, err = cache.Request("https://arxiv.org/abs/1805.09547")
+	assert.NoError(t, err)
+	assert.Len(t, calls, 2)
+
+	// a refresh ignores the cache
+	_, err = cache.Refresh("https://arxiv.org/abs/1805.09547")
+	assert.NoError(t, err)
+	assert.Equal(t, pageValidators{}, calls[2])
+
+	// a stale paper is served while the site is down
+	now = now.Add(2 * time.Hour)
+	fetchErr = errors.New("connection refused")
+	paper, err = cache.Request("https://arxiv.org/abs/1805.09547")
+	assert.NoError(t, err)
+	assert.Equal(t, "A Paper", paper.Title)
+	// but a refresh fails rather than pass it off as fresh
+	_, err = cache.Refresh("https://arxiv.org/abs/1805.09547")
+	assert.EqualError(t, err, "connection refused")
+
+	// papers not found are remembered for a while
+	fetchErr = &PageStatusError{StatusCode: http.StatusNotFound}
+	_, err = cache.Request("https://arxiv.org/abs/1805.00001")
+	assert.Error(t, err)
+	_, err = cache.Request("https://arxiv.org/abs/1805.00001")
+	assert.Error(t, err)
+	assert.Len(t, calls, 6)
+	now = now.Add(2 * time.Minute)
+	_, err = cache.Request("https://arxiv.org/abs/1805.00001")
+	assert.Error(t, err)
+	assert.Len(t, calls, 7)
+
+	// the cache survives a restart
+	cache, err = NewPaperCache(store, time.Hour, time.Minute)
+	assert.NoError(t, err)
+	cache.now = func() time.Time { return now }
+	cache.fetch = nil
+	_, err = cache.Request("https://arxiv.org/abs/1805.00001")
+	assert.Error(t, err)
+}
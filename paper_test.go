@@ -42,3 +42,30 @@ func TestFromAclweb(t *testing.T) {
 	assert.Equal(t, "http://aclweb.org/anthology/P18-1200.bib", paper.BibUrl)
 	assert.Equal(t, "", paper.Comment)
 }
+
+func TestUnversionedArxivId(t *testing.T) {
+	for rawurl, expected := range map[string]string{
+		"https://arxiv.org/abs/1805.09547":       "1805.09547",
+		"https://arxiv.org/abs/1805.09547v3":     "1805.09547",
+		"https://arxiv.org/pdf/1805.09547v2.pdf": "1805.09547",
+	} {
+		assert.Equal(t, expected, unversionedArxivId(rawurl), rawurl)
+	}
+}
+
+func TestCanonicalId(t *testing.T) {
+	for rawurl, expected := range map[string]string{
+		"https://arxiv.org/abs/1805.09547":                   "arxiv:1805.09547",
+		"https://arxiv.org/pdf/1805.09547v2.pdf":             "arxiv:1805.09547",
+		"http://aclweb.org/anthology/P18-1200":               "acl:P18-1200",
+		"https://aclanthology.info/papers/P18-1200/p18-1200": "acl:P18-1200",
+		"https://openreview.net/forum?id=rJ4km2R5t7":         "openreview:rJ4km2R5t7",
+	} {
+		id, err := CanonicalId(rawurl)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, id, rawurl)
+	}
+
+	_, err := CanonicalId("https://example.com/arxiv.org")
+	assert.Error(t, err)
+}
@@ -0,0 +1,125 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrClosed is returned when pushing to a closed queue, and when popping
+// from a closed queue that has been drained.
+var ErrClosed = errors.New("queue: closed")
+
+// ConcurrentQueue is a double-ended queue of elements of type T that is safe
+// for concurrent use. PopFront blocks until an element is available, making
+// it suitable for handing work from producers to consumers.
+type ConcurrentQueue[T any] struct {
+	mu     sync.Mutex
+	q      Queue[T]
+	closed bool
+	// pushed is closed, and replaced, whenever an element is pushed or the
+	// queue is closed, waking up blocked consumers.
+	pushed chan struct{}
+}
+
+// NewConcurrent returns an initialized empty concurrent queue.
+func NewConcurrent[T any]() *ConcurrentQueue[T] {
+	c := &ConcurrentQueue[T]{pushed: make(chan struct{})}
+	c.q.Init()
+	return c
+}
+
+// Len returns the number of elements of queue c.
+func (c *ConcurrentQueue[T]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.q.Len()
+}
+
+// Front returns the first element of queue c, or false if c is empty. With
+// several consumers, the element may be popped by another before it is acted
+// on.
+func (c *ConcurrentQueue[T]) Front() (T, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.q.Front()
+}
+
+// PushFront inserts a new value v at the front of queue c.
+func (c *ConcurrentQueue[T]) PushFront(v T) error {
+	return c.push(func() { c.q.PushFront(v) })
+}
+
+// PushBack inserts a new value v at the back of queue c.
+func (c *ConcurrentQueue[T]) PushBack(v T) error {
+	return c.push(func() { c.q.PushBack(v) })
+}
+
+func (c *ConcurrentQueue[T]) push(f func()) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+	f()
+	c.wake()
+	return nil
+}
+
+// wake wakes up blocked consumers; c.mu must be held.
+func (c *ConcurrentQueue[T]) wake() {
+	close(c.pushed)
+	c.pushed = make(chan struct{})
+}
+
+// TryPop removes and returns the first element of queue c, or false if the
+// queue is empty.
+func (c *ConcurrentQueue[T]) TryPop() (T, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.q.PopFront()
+}
+
+// PopFront removes and returns the first element of queue c, waiting for
+// one to be pushed if it is empty. It returns ctx.Err() if ctx is done
+// first, and ErrClosed once c is closed and drained.
+func (c *ConcurrentQueue[T]) PopFront(ctx context.Context) (T, error) {
+	var zero T
+	for {
+		c.mu.Lock()
+		if v, ok := c.q.PopFront(); ok {
+			c.mu.Unlock()
+			return v, nil
+		}
+		if c.closed {
+			c.mu.Unlock()
+			return zero, ErrClosed
+		}
+		pushed := c.pushed
+		c.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return zero, ctx.Err()
+		case <-pushed:
+		}
+	}
+}
+
+// Close stops queue c accepting new elements. Elements already in it can
+// still be popped; consumers blocked on an empty queue return ErrClosed.
+// Closing a closed queue has no effect.
+func (c *ConcurrentQueue[T]) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.wake()
+}
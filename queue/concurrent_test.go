@@ -0,0 +1,138 @@
+package queue
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentQueue(t *testing.T) {
+	c := NewConcurrent[int]()
+	_, ok := c.TryPop()
+	assert.False(t, ok)
+	_, ok = c.Front()
+	assert.False(t, ok)
+
+	assert.NoError(t, c.PushBack(2))
+	assert.NoError(t, c.PushFront(1))
+	assert.Equal(t, 2, c.Len())
+	v, ok := c.Front()
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	v, ok = c.TryPop()
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+	v, err := c.PopFront(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, v)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestConcurrentQueueBlocks(t *testing.T) {
+	c := NewConcurrent[string]()
+	popped := make(chan string)
+	go func() {
+		v, err := c.PopFront(context.Background())
+		assert.NoError(t, err)
+		popped <- v
+	}()
+
+	select {
+	case <-popped:
+		t.Fatal("PopFront returned from an empty queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.NoError(t, c.PushBack("a"))
+	select {
+	case v := <-popped:
+		assert.Equal(t, "a", v)
+	case <-time.After(5 * time.Second):
+		t.Fatal("PopFront was not woken up")
+	}
+}
+
+func TestConcurrentQueueCancel(t *testing.T) {
+	c := NewConcurrent[int]()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := c.PopFront(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestConcurrentQueueClose(t *testing.T) {
+	c := NewConcurrent[int]()
+	assert.NoError(t, c.PushBack(1))
+
+	errs := make(chan error)
+	go func() {
+		// the element pushed before Close is still delivered
+		_, err := c.PopFront(context.Background())
+		assert.NoError(t, err)
+		_, err = c.PopFront(context.Background())
+		errs <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	c.Close()
+	c.Close()
+
+	select {
+	case err := <-errs:
+		assert.Equal(t, ErrClosed, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("PopFront was not woken up by Close")
+	}
+	assert.Equal(t, ErrClosed, c.PushBack(2))
+	assert.Equal(t, ErrClosed, c.PushFront(2))
+}
+
+func TestConcurrentQueueProducersConsumers(t *testing.T) {
+	const producers, consumers, perProducer = 4, 4, 1000
+	c := NewConcurrent[int]()
+
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < perProducer; i++ {
+				assert.NoError(t, c.PushBack(p*perProducer+i))
+			}
+		}(p)
+	}
+
+	var mu sync.Mutex
+	var got []int
+	var cwg sync.WaitGroup
+	for i := 0; i < consumers; i++ {
+		cwg.Add(1)
+		go func() {
+			defer cwg.Done()
+			for {
+				v, err := c.PopFront(context.Background())
+				if err != nil {
+					assert.Equal(t, ErrClosed, err)
+					return
+				}
+				mu.Lock()
+				got = append(got, v)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	c.Close()
+	cwg.Wait()
+
+	assert.Len(t, got, producers*perProducer)
+	sort.Ints(got)
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("element %d missing", i)
+		}
+	}
+}
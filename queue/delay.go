@@ -0,0 +1,154 @@
+package queue
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// DelayQueue is a queue of elements of type T that each become visible at a
+// given time, and are popped in that order. It is safe for concurrent use,
+// and PopFront blocks until an element is due.
+type DelayQueue[T any] struct {
+	mu     sync.Mutex
+	h      itemHeap[T]
+	seq    uint64
+	closed bool
+	// pushed is closed, and replaced, whenever an element is pushed or the
+	// queue is closed, so that consumers recompute how long to wait.
+	pushed chan struct{}
+	// now is replaceable for tests.
+	now func() time.Time
+}
+
+// NewDelay returns an initialized empty delay queue.
+func NewDelay[T any]() *DelayQueue[T] {
+	d := &DelayQueue[T]{pushed: make(chan struct{}), now: time.Now}
+	d.h.less = func(a, b item[T]) bool {
+		if !a.at.Equal(b.at) {
+			return a.at.Before(b.at)
+		}
+		return a.seq < b.seq
+	}
+	return d
+}
+
+// Len returns the number of elements of queue d, due or not.
+func (d *DelayQueue[T]) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.h.Len()
+}
+
+// Front returns the earliest element of queue d and when it is due, or
+// false if d is empty.
+func (d *DelayQueue[T]) Front() (T, time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.h.Len() == 0 {
+		var zero T
+		return zero, time.Time{}, false
+	}
+	return d.h.items[0].value, d.h.items[0].at, true
+}
+
+// Push inserts a new value v into queue d, to become visible at at.
+func (d *DelayQueue[T]) Push(v T, at time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return ErrClosed
+	}
+	d.seq++
+	heap.Push(&d.h, item[T]{value: v, at: at, seq: d.seq})
+	close(d.pushed)
+	d.pushed = make(chan struct{})
+	return nil
+}
+
+// TryPop removes and returns the earliest element of queue d if it is due,
+// or false otherwise.
+func (d *DelayQueue[T]) TryPop() (T, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.h.Len() == 0 || d.h.items[0].at.After(d.now()) {
+		var zero T
+		return zero, false
+	}
+	return d.h.pop()
+}
+
+// PopFront removes and returns the earliest element of queue d, waiting
+// until it is due. It returns ctx.Err() if ctx is done first, and ErrClosed
+// once d is closed and drained. Elements not yet due are still delivered
+// after Close.
+func (d *DelayQueue[T]) PopFront(ctx context.Context) (T, error) {
+	var zero T
+	for {
+		d.mu.Lock()
+		if d.h.Len() == 0 && d.closed {
+			d.mu.Unlock()
+			return zero, ErrClosed
+		}
+		var timer *time.Timer
+		var wait <-chan time.Time
+		var err error
+		if d.h.Len() > 0 {
+			delay := d.h.items[0].at.Sub(d.now())
+			if delay <= 0 {
+				v, _ := d.h.pop()
+				d.mu.Unlock()
+				return v, nil
+			}
+			timer = time.NewTimer(delay)
+			wait = timer.C
+		}
+		pushed := d.pushed
+		d.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-pushed:
+		case <-wait:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err != nil {
+			return zero, err
+		}
+	}
+}
+
+// Range calls f for each element of queue d, due or not, with the time it
+// is due, until f returns false. The elements are visited in no particular
+// order, and f must not call methods of d.
+func (d *DelayQueue[T]) Range(f func(v T, at time.Time) bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, it := range d.h.items {
+		if !f(it.value, it.at) {
+			return
+		}
+	}
+}
+
+// Close stops queue d accepting new elements, as ConcurrentQueue.Close.
+func (d *DelayQueue[T]) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return
+	}
+	d.closed = true
+	close(d.pushed)
+	d.pushed = make(chan struct{})
+}
@@ -0,0 +1,122 @@
+package queue
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue(t *testing.T) {
+	d := NewDelay[string]()
+	now := time.Date(2018, 11, 9, 12, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+
+	assert.NoError(t, d.Push("later", now.Add(time.Hour)))
+	assert.NoError(t, d.Push("soon", now.Add(time.Minute)))
+	assert.NoError(t, d.Push("also soon", now.Add(time.Minute)))
+	assert.Equal(t, 3, d.Len())
+
+	v, at, ok := d.Front()
+	assert.True(t, ok)
+	assert.Equal(t, "soon", v)
+	assert.Equal(t, now.Add(time.Minute), at)
+	_, ok = d.TryPop()
+	assert.False(t, ok, "nothing is due yet")
+
+	now = now.Add(time.Minute)
+	v, ok = d.TryPop()
+	assert.True(t, ok)
+	assert.Equal(t, "soon", v)
+	v, ok = d.TryPop()
+	assert.True(t, ok)
+	assert.Equal(t, "also soon", v)
+	_, ok = d.TryPop()
+	assert.False(t, ok)
+	assert.Equal(t, 1, d.Len())
+	d.Range(func(v string, at time.Time) bool {
+		assert.Equal(t, "later", v)
+		assert.Equal(t, now.Add(59*time.Minute), at)
+		return true
+	})
+}
+
+func TestDelayQueueBlocks(t *testing.T) {
+	d := NewDelay[string]()
+	start := time.Now()
+	assert.NoError(t, d.Push("b", start.Add(100*time.Millisecond)))
+
+	popped := make(chan string)
+	go func() {
+		for i := 0; i < 2; i++ {
+			v, err := d.PopFront(context.Background())
+			assert.NoError(t, err)
+			popped <- v
+		}
+	}()
+	// an earlier element pushed while waiting is popped first
+	time.Sleep(10 * time.Millisecond)
+	assert.NoError(t, d.Push("a", start.Add(30*time.Millisecond)))
+
+	assert.Equal(t, "a", <-popped)
+	assert.True(t, time.Since(start) >= 30*time.Millisecond)
+	assert.Equal(t, "b", <-popped)
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+}
+
+func TestDelayQueueClose(t *testing.T) {
+	d := NewDelay[int]()
+	assert.NoError(t, d.Push(1, time.Now().Add(20*time.Millisecond)))
+	d.Close()
+	assert.Equal(t, ErrClosed, d.Push(2, time.Now()))
+
+	// elements pushed before Close are still delivered when due
+	v, err := d.PopFront(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, v)
+	_, err = d.PopFront(context.Background())
+	assert.Equal(t, ErrClosed, err)
+
+	d = NewDelay[int]()
+	assert.NoError(t, d.Push(1, time.Now().Add(time.Hour)))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = d.PopFront(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestDelayQueueConcurrent(t *testing.T) {
+	d := NewDelay[int]()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				assert.NoError(t, d.Push(j, time.Now().Add(time.Duration(j%5)*time.Millisecond)))
+			}
+		}(i)
+	}
+	var mu sync.Mutex
+	count := 0
+	var cwg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		cwg.Add(1)
+		go func() {
+			defer cwg.Done()
+			for {
+				if _, err := d.PopFront(context.Background()); err != nil {
+					return
+				}
+				mu.Lock()
+				count++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	d.Close()
+	cwg.Wait()
+	assert.Equal(t, 400, count)
+}
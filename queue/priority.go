@@ -0,0 +1,173 @@
+package queue
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// PriorityQueue is a queue of elements of type T popped highest priority
+// first, and in insertion order among equal priorities. It is safe for
+// concurrent use, and PopFront blocks until an element is available.
+type PriorityQueue[T any] struct {
+	mu     sync.Mutex
+	h      itemHeap[T]
+	seq    uint64
+	closed bool
+	// pushed is closed, and replaced, whenever an element is pushed or the
+	// queue is closed, waking up blocked consumers.
+	pushed chan struct{}
+}
+
+// NewPriority returns an initialized empty priority queue.
+func NewPriority[T any]() *PriorityQueue[T] {
+	p := &PriorityQueue[T]{pushed: make(chan struct{})}
+	p.h.less = func(a, b item[T]) bool {
+		if a.priority != b.priority {
+			return a.priority > b.priority
+		}
+		return a.seq < b.seq
+	}
+	return p
+}
+
+// Len returns the number of elements of queue p.
+func (p *PriorityQueue[T]) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.h.Len()
+}
+
+// Front returns the element of queue p to be popped next, or false if p is
+// empty.
+func (p *PriorityQueue[T]) Front() (T, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.h.front()
+}
+
+// Push inserts a new value v with priority into queue p.
+func (p *PriorityQueue[T]) Push(v T, priority int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return ErrClosed
+	}
+	p.seq++
+	heap.Push(&p.h, item[T]{value: v, priority: priority, seq: p.seq})
+	close(p.pushed)
+	p.pushed = make(chan struct{})
+	return nil
+}
+
+// TryPop removes and returns the highest priority element of queue p, or
+// false if p is empty.
+func (p *PriorityQueue[T]) TryPop() (T, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.h.pop()
+}
+
+// PopFront removes and returns the highest priority element of queue p,
+// waiting for one to be pushed if it is empty. It returns ctx.Err() if ctx
+// is done first, and ErrClosed once p is closed and drained.
+func (p *PriorityQueue[T]) PopFront(ctx context.Context) (T, error) {
+	var zero T
+	for {
+		p.mu.Lock()
+		if v, ok := p.h.pop(); ok {
+			p.mu.Unlock()
+			return v, nil
+		}
+		if p.closed {
+			p.mu.Unlock()
+			return zero, ErrClosed
+		}
+		pushed := p.pushed
+		p.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return zero, ctx.Err()
+		case <-pushed:
+		}
+	}
+}
+
+// Range calls f for each element of queue p, with its priority, until f
+// returns false. The elements are visited in no particular order, and f
+// must not call methods of p.
+func (p *PriorityQueue[T]) Range(f func(v T, priority int) bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, it := range p.h.items {
+		if !f(it.value, it.priority) {
+			return
+		}
+	}
+}
+
+// Close stops queue p accepting new elements, as ConcurrentQueue.Close.
+func (p *PriorityQueue[T]) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return
+	}
+	p.closed = true
+	close(p.pushed)
+	p.pushed = make(chan struct{})
+}
+
+// item is an element of a PriorityQueue or DelayQueue.
+type item[T any] struct {
+	value    T
+	priority int
+	at       time.Time
+	seq      uint64
+}
+
+// itemHeap implements heap.Interface ordered by less.
+type itemHeap[T any] struct {
+	items []item[T]
+	less  func(a, b item[T]) bool
+}
+
+func (h *itemHeap[T]) Len() int           { return len(h.items) }
+func (h *itemHeap[T]) Less(i, j int) bool { return h.less(h.items[i], h.items[j]) }
+func (h *itemHeap[T]) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *itemHeap[T]) Push(x interface{}) {
+	h.items = append(h.items, x.(item[T]))
+}
+
+func (h *itemHeap[T]) Pop() interface{} {
+	n := len(h.items) - 1
+	it := h.items[n]
+	h.items[n] = item[T]{} // unused slots must be zero
+	h.items = h.items[:n]
+	return it
+}
+
+func (h *itemHeap[T]) front() (T, bool) {
+	if len(h.items) == 0 {
+		var zero T
+		return zero, false
+	}
+	return h.items[0].value, true
+}
+
+func (h *itemHeap[T]) pop() (T, bool) {
+	if len(h.items) == 0 {
+		var zero T
+		return zero, false
+	}
+	return heap.Pop(h).(item[T]).value, true
+}
@@ -0,0 +1,109 @@
+package queue
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueue(t *testing.T) {
+	p := NewPriority[string]()
+	_, ok := p.TryPop()
+	assert.False(t, ok)
+
+	assert.NoError(t, p.Push("digest 1", 0))
+	assert.NoError(t, p.Push("digest 2", 0))
+	assert.NoError(t, p.Push("reply", 10))
+	assert.NoError(t, p.Push("low", -1))
+	assert.Equal(t, 4, p.Len())
+	front, ok := p.Front()
+	assert.True(t, ok)
+	assert.Equal(t, "reply", front)
+	priorities := map[string]int{}
+	p.Range(func(v string, priority int) bool {
+		priorities[v] = priority
+		return true
+	})
+	assert.Equal(t, map[string]int{"digest 1": 0, "digest 2": 0, "reply": 10, "low": -1}, priorities)
+
+	var popped []string
+	for p.Len() > 0 {
+		v, err := p.PopFront(context.Background())
+		assert.NoError(t, err)
+		popped = append(popped, v)
+	}
+	assert.Equal(t, []string{"reply", "digest 1", "digest 2", "low"}, popped)
+}
+
+func TestPriorityQueueBlocksAndCloses(t *testing.T) {
+	p := NewPriority[int]()
+	popped := make(chan int)
+	go func() {
+		v, err := p.PopFront(context.Background())
+		assert.NoError(t, err)
+		popped <- v
+		_, err = p.PopFront(context.Background())
+		assert.Equal(t, ErrClosed, err)
+		close(popped)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	assert.NoError(t, p.Push(1, 0))
+	assert.Equal(t, 1, <-popped)
+	p.Close()
+	_, ok := <-popped
+	assert.False(t, ok)
+	assert.Equal(t, ErrClosed, p.Push(2, 0))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := NewPriority[int]().PopFront(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestPriorityQueueConcurrent(t *testing.T) {
+	p := NewPriority[int]()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				assert.NoError(t, p.Push(j, j%3))
+			}
+		}(i)
+	}
+	var mu sync.Mutex
+	count := 0
+	var cwg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		cwg.Add(1)
+		go func() {
+			defer cwg.Done()
+			for {
+				if _, err := p.PopFront(context.Background()); err != nil {
+					return
+				}
+				mu.Lock()
+				count++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	p.Close()
+	cwg.Wait()
+	assert.Equal(t, 2000, count)
+}
+
+func BenchmarkPriorityQueue(b *testing.B) {
+	p := NewPriority[int]()
+	for i := 0; i < b.N; i++ {
+		_ = p.Push(i, i%8)
+	}
+	for i := 0; i < b.N; i++ {
+		p.TryPop()
+	}
+}
@@ -0,0 +1,137 @@
+package queue
+
+import (
+	"container/list"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestQueue(t *testing.T) {
+	var q Queue[string]
+	_, ok := q.Front()
+	assert.False(t, ok)
+	_, ok = q.PopBack()
+	assert.False(t, ok)
+
+	q.PushBack("b")
+	q.PushBack("c")
+	q.PushFront("a")
+	assert.Equal(t, 3, q.Len())
+	assert.Equal(t, "[a b c]", q.String())
+	front, _ := q.Front()
+	back, _ := q.Back()
+	assert.Equal(t, "a", front)
+	assert.Equal(t, "c", back)
+	assert.Equal(t, "b", q.At(1))
+	assert.Panics(t, func() { q.At(3) })
+	assert.Panics(t, func() { q.At(-1) })
+
+	v, ok := q.PopFront()
+	assert.True(t, ok)
+	assert.Equal(t, "a", v)
+	v, ok = q.PopBack()
+	assert.True(t, ok)
+	assert.Equal(t, "c", v)
+	assert.Equal(t, 1, q.Len())
+
+	q.Clear()
+	assert.Equal(t, 0, q.Len())
+	_, ok = q.PopFront()
+	assert.False(t, ok)
+}
+
+func TestQueueWrapAround(t *testing.T) {
+	q := New[int]()
+	// keep the ring buffer wrapped while it grows and shrinks
+	for i := 0; i < 100; i++ {
+		q.PushBack(i)
+		q.PushFront(-i - 1)
+	}
+	for i := 0; i < q.Len(); i++ {
+		assert.Equal(t, i-100, q.At(i))
+	}
+	var seen []int
+	q.Range(func(i, v int) bool {
+		assert.Equal(t, q.At(i), v)
+		seen = append(seen, v)
+		return i < 9
+	})
+	assert.Len(t, seen, 10)
+
+	for i := 0; i < 190; i++ {
+		if i%2 == 0 {
+			q.PopFront()
+		} else {
+			q.PopBack()
+		}
+	}
+	assert.Equal(t, 10, q.Len())
+	assert.True(t, len(q.rep) < 64, "storage is not shrunk: %d", len(q.rep))
+	for i := 0; i < q.Len(); i++ {
+		assert.Equal(t, i-5, q.At(i))
+	}
+}
+
+func BenchmarkPushBackPopFront(b *testing.B) {
+	var q Queue[int]
+	for i := 0; i < b.N; i++ {
+		q.PushBack(i)
+	}
+	for i := 0; i < b.N; i++ {
+		q.PopFront()
+	}
+}
+
+func BenchmarkPushFrontPopBack(b *testing.B) {
+	var q Queue[int]
+	for i := 0; i < b.N; i++ {
+		q.PushFront(i)
+	}
+	for i := 0; i < b.N; i++ {
+		q.PopBack()
+	}
+}
+
+// BenchmarkSteady keeps a few elements in the queue, as bot.go does.
+func BenchmarkSteady(b *testing.B) {
+	var q Queue[int]
+	for i := 0; i < 8; i++ {
+		q.PushBack(i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		q.PushBack(i)
+		q.PopFront()
+	}
+}
+
+func BenchmarkAt(b *testing.B) {
+	var q Queue[int]
+	for i := 0; i < 1024; i++ {
+		q.PushBack(i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		q.At(i & 1023)
+	}
+}
+
+func BenchmarkList(b *testing.B) {
+	l := list.New()
+	for i := 0; i < b.N; i++ {
+		l.PushBack(i)
+	}
+	for i := 0; i < b.N; i++ {
+		l.Remove(l.Front())
+	}
+}
+
+func BenchmarkChannel(b *testing.B) {
+	c := make(chan int, b.N)
+	for i := 0; i < b.N; i++ {
+		c <- i
+	}
+	for i := 0; i < b.N; i++ {
+		<-c
+	}
+}
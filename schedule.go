@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Schedule tells when a job runs: at the times matching a cron expression
+// in a time zone, except on skipped days.
+type Schedule struct {
+	cron     *cronExpr
+	Location *time.Location
+	// SkipWeekends skips Saturdays and Sundays.
+	SkipWeekends bool
+	// Holidays are skipped dates formatted as "2006-01-02".
+	Holidays map[string]bool
+}
+
+// ParseSchedule parses a cron expression such as "0 12 * * 1-5" to be
+// evaluated in loc.
+func ParseSchedule(expr string, loc *time.Location) (*Schedule, error) {
+	c, err := parseCron(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &Schedule{cron: c, Location: loc}, nil
+}
+
+// ParseHolidays parses a comma-separated list of dates such as
+// "2018-12-25,2019-01-01".
+func ParseHolidays(s string) (map[string]bool, error) {
+	holidays := map[string]bool{}
+	for _, date := range strings.Split(s, ",") {
+		date = strings.TrimSpace(date)
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return nil, fmt.Errorf("invalid holiday: %q", date)
+		}
+		holidays[date] = true
+	}
+	return holidays, nil
+}
+
+// Next returns the first run after t, or the zero time if there is none.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.In(s.Location)
+	// like the cron expression, a schedule whose runs all fall on skipped
+	// days is given up on after a leap year cycle
+	limit := t.AddDate(5, 0, 0)
+	for {
+		t = s.cron.Next(t)
+		if t.IsZero() || t.After(limit) {
+			return time.Time{}
+		}
+		if !s.skipped(t) {
+			return t
+		}
+	}
+}
+
+func (s *Schedule) skipped(t time.Time) bool {
+	if s.SkipWeekends && (t.Weekday() == time.Saturday || t.Weekday() == time.Sunday) {
+		return true
+	}
+	return s.Holidays[t.Format("2006-01-02")]
+}
+
+// Job is a named task run on a schedule.
+type Job struct {
+	Name     string
+	Schedule *Schedule
+	Run      func()
+}
+
+// JobRun tells when a job last ran and runs next.
+type JobRun struct {
+	Name    string
+	LastRun time.Time
+	Next    time.Time
+}
+
+// Scheduler runs jobs on their schedules and remembers when each last ran,
+// so that a run missed while the bot was down is made up on start-up.
+type Scheduler struct {
+	store   *Store
+	mu      sync.Mutex
+	jobs    []*Job
+	lastRun map[string]time.Time
+}
+
+func NewScheduler(store *Store) (*Scheduler, error) {
+	s := &Scheduler{store: store, lastRun: map[string]time.Time{}}
+	if err := store.Load("schedule", &s.lastRun); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Add registers a job. Jobs are started by Run.
+func (s *Scheduler) Add(name string, schedule *Schedule, run func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs = append(s.jobs, &Job{Name: name, Schedule: schedule, Run: run})
+}
+
+// Run runs every job on its schedule until ctx is done, then waits for the
+// jobs running to finish. A job that missed one or more runs since it last
+// ran is run once right away; a job that never ran waits for its first
+// scheduled time.
+func (s *Scheduler) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	s.mu.Lock()
+	now := time.Now()
+	for _, job := range s.jobs {
+		last, ok := s.lastRun[job.Name]
+		missed := ok && !job.Schedule.Next(last).After(now)
+		wg.Add(1)
+		go func(job *Job) {
+			defer wg.Done()
+			s.loop(ctx, job, missed)
+		}(job)
+	}
+	s.mu.Unlock()
+
+	<-ctx.Done()
+	wg.Wait()
+	return nil
+}
+
+func (s *Scheduler) loop(ctx context.Context, job *Job, runNow bool) {
+	if runNow {
+		scheduleLog.Info("catching up", "job", job.Name)
+		s.run(job)
+	}
+	for {
+		next := job.Schedule.Next(time.Now())
+		if next.IsZero() {
+			scheduleLog.Warn("job will never run again", "job", job.Name)
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.run(job)
+	}
+}
+
+func (s *Scheduler) run(job *Job) {
+	start := time.Now()
+	// a crashed run counts as a run, so that it is not made up on start-up
+	// only to crash again
+	if err := protect(func() error { job.Run(); return nil }); err != nil {
+		scheduleLog.Error("job crashed", "job", job.Name, "error", err)
+	}
+	jobRuns.Inc(job.Name)
+	jobDuration.Observe(time.Since(start).Seconds(), job.Name)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastRun[job.Name] = time.Now()
+	if err := s.store.Save("schedule", s.lastRun); err != nil {
+		storeLog.Error("store error", "error", err)
+	}
+}
+
+// Runs returns the last and next runs of every job after now, soonest
+// first.
+func (s *Scheduler) Runs(now time.Time) []JobRun {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var runs []JobRun
+	for _, job := range s.jobs {
+		runs = append(runs, JobRun{
+			Name:    job.Name,
+			LastRun: s.lastRun[job.Name],
+			Next:    job.Schedule.Next(now),
+		})
+	}
+	// jobs that are never to run again come last
+	sort.SliceStable(runs, func(i, j int) bool {
+		if runs[i].Next.IsZero() || runs[j].Next.IsZero() {
+			return !runs[i].Next.IsZero() && runs[j].Next.IsZero()
+		}
+		return runs[i].Next.Before(runs[j].Next)
+	})
+	return runs
+}
+
+// formatJobRuns lists jobs with their next runs in the schedule's time zone.
+func formatJobRuns(runs []JobRun, loc *time.Location) string {
+	if len(runs) == 0 {
+		return "No scheduled jobs."
+	}
+	var b strings.Builder
+	_, _ = b.WriteString("*Scheduled jobs*")
+	for _, r := range runs {
+		next := "never"
+		if !r.Next.IsZero() {
+			next = r.Next.In(loc).Format("Mon Jan 2 15:04 MST")
+		}
+		last := "never"
+		if !r.LastRun.IsZero() {
+			last = r.LastRun.In(loc).Format("Mon Jan 2 15:04 MST")
+		}
+		_, _ = fmt.Fprintf(&b, "\n• %s: next %s (last %s)", r.Name, next, last)
+	}
+	return b.String()
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	assert.NoError(t, err)
+	// Friday
+	from := time.Date(2018, 11, 9, 12, 30, 0, 0, tokyo)
+
+	tests := []struct {
+		expr string
+		next time.Time
+	}{
+		{"0 12 * * *", time.Date(2018, 11, 10, 12, 0, 0, 0, tokyo)},
+		{"@hourly", time.Date(2018, 11, 9, 13, 0, 0, 0, tokyo)},
+		{"*/15 9-17 * * *", time.Date(2018, 11, 9, 12, 45, 0, 0, tokyo)},
+		{"0 9 * * mon-fri", time.Date(2018, 11, 12, 9, 0, 0, 0, tokyo)},
+		{"0 9 * * 7", time.Date(2018, 11, 11, 9, 0, 0, 0, tokyo)},
+		{"0 0 1 jan *", time.Date(2019, 1, 1, 0, 0, 0, 0, tokyo)},
+		// either day field matches if both are restricted
+		{"0 0 13 * fri", time.Date(2018, 11, 13, 0, 0, 0, 0, tokyo)},
+		{"0 0 29 2 *", time.Date(2020, 2, 29, 0, 0, 0, 0, tokyo)},
+	}
+	for _, test := range tests {
+		s, err := ParseSchedule(test.expr, tokyo)
+		assert.NoError(t, err, test.expr)
+		assert.Equal(t, test.next, s.Next(from), test.expr)
+	}
+
+	// the time zone is the schedule's, not the caller's
+	s, err := ParseSchedule("0 12 * * *", tokyo)
+	assert.NoError(t, err)
+	assert.True(t, time.Date(2018, 11, 10, 12, 0, 0, 0, tokyo).Equal(s.Next(from.UTC())))
+
+	s.SkipWeekends = true
+	s.Holidays, err = ParseHolidays("2018-11-12, 2018-11-13")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2018, 11, 14, 12, 0, 0, 0, tokyo), s.Next(from))
+
+	// a schedule that only runs on skipped days never runs
+	s, err = ParseSchedule("0 9 * * sun", tokyo)
+	assert.NoError(t, err)
+	s.SkipWeekends = true
+	assert.True(t, s.Next(from).IsZero())
+
+	for _, expr := range []string{"0 12 * *", "60 * * * *", "* * * * 8", "*/0 * * * *", "0 12 * * someday"} {
+		_, err := ParseSchedule(expr, tokyo)
+		assert.Error(t, err, expr)
+	}
+	_, err = ParseHolidays("2018-11-31")
+	assert.Error(t, err)
+}
+
+func TestScheduleDaylightSaving(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+	s, err := ParseSchedule("30 2 * * *", ny)
+	assert.NoError(t, err)
+	// 2:30 does not exist on the day clocks go forward
+	assert.Equal(t, time.Date(2019, 3, 11, 2, 30, 0, 0, ny), s.Next(time.Date(2019, 3, 10, 0, 0, 0, 0, ny)))
+}
+
+func TestSchedulerRuns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "paperbot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store, err := NewStore(dir)
+	assert.NoError(t, err)
+	scheduler, err := NewScheduler(store)
+	assert.NoError(t, err)
+
+	daily, err := ParseSchedule("0 12 * * *", time.UTC)
+	assert.NoError(t, err)
+	hourly, err := ParseSchedule("0 * * * *", time.UTC)
+	assert.NoError(t, err)
+	never, err := ParseSchedule("0 12 30 2 *", time.UTC)
+	assert.NoError(t, err)
+	scheduler.Add("february 30", never, func() {})
+	scheduler.Add("trending", daily, func() {})
+	scheduler.Add("new submissions", hourly, func() {})
+
+	now := time.Date(2018, 11, 9, 10, 30, 0, 0, time.UTC)
+	runs := scheduler.Runs(now)
+	assert.Equal(t, []JobRun{
+		{Name: "new submissions", Next: time.Date(2018, 11, 9, 11, 0, 0, 0, time.UTC)},
+		{Name: "trending", Next: time.Date(2018, 11, 9, 12, 0, 0, 0, time.UTC)},
+		{Name: "february 30"},
+	}, runs)
+	assert.Equal(t, "*Scheduled jobs*\n"+
+		"• new submissions: next Fri Nov 9 11:00 UTC (last never)\n"+
+		"• trending: next Fri Nov 9 12:00 UTC (last never)\n"+
+		"• february 30: next never (last never)", formatJobRuns(runs, time.UTC))
+}
+
+func TestSchedulerCatchUp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "paperbot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store, err := NewStore(dir)
+	assert.NoError(t, err)
+	// trending last ran two days ago, so today's run was missed
+	assert.NoError(t, store.Save("schedule", map[string]time.Time{
+		"trending": time.Now().Add(-48 * time.Hour),
+	}))
+
+	scheduler, err := NewScheduler(store)
+	assert.NoError(t, err)
+	daily, err := ParseSchedule("0 12 * * *", time.UTC)
+	assert.NoError(t, err)
+	ran := make(chan string, 2)
+	scheduler.Add("trending", daily, func() { ran <- "trending" })
+	// a job that never ran waits for its time
+	scheduler.Add("weekly digest", daily, func() { ran <- "weekly digest" })
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		scheduler.Run(ctx)
+		close(stopped)
+	}()
+
+	select {
+	case name := <-ran:
+		assert.Equal(t, "trending", name)
+	case <-time.After(5 * time.Second):
+		t.Fatal("missed run was not made up")
+	}
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not stop")
+	}
+	for _, r := range scheduler.Runs(time.Now()) {
+		if r.Name == "trending" {
+			assert.WithinDuration(t, time.Now(), r.LastRun, 5*time.Second)
+		}
+	}
+}
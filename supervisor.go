@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/reiyw/paperbot/metrics"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+var restarts = metrics.NewCounter("paperbot_restarts_total",
+	"Restarts of subsystems that crashed or stopped, by subsystem.", "subsystem")
+
+// Supervisor runs the long-lived subsystems of the bot until its context is
+// done, restarting any that crash or stop early with increasing backoff. It
+// also keeps track of shorter tasks, so that shutdown can wait for them.
+type Supervisor struct {
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Healthy is how long a subsystem must run for its backoff to be reset.
+	Healthy time.Duration
+
+	ctx        context.Context
+	subsystems sync.WaitGroup
+	tasks      sync.WaitGroup
+}
+
+func NewSupervisor(ctx context.Context) *Supervisor {
+	return &Supervisor{
+		MinBackoff: time.Second,
+		MaxBackoff: time.Minute,
+		Healthy:    time.Minute,
+		ctx:        ctx,
+	}
+}
+
+// Go runs the subsystem name in the background until the supervisor's
+// context is done. run is expected to return only once ctx is done.
+func (s *Supervisor) Go(name string, run func(ctx context.Context) error) {
+	s.subsystems.Add(1)
+	go func() {
+		defer s.subsystems.Done()
+		backoff := s.MinBackoff
+		for {
+			start := time.Now()
+			err := protect(func() error { return run(s.ctx) })
+			if s.ctx.Err() != nil {
+				return
+			}
+			if err == nil {
+				err = fmt.Errorf("stopped")
+			}
+			if time.Since(start) >= s.Healthy {
+				backoff = s.MinBackoff
+			}
+			lifecycleLog.Error("restarting", "subsystem", name, "backoff", backoff, "error", err)
+			restarts.Inc(name)
+
+			timer := time.NewTimer(backoff)
+			select {
+			case <-s.ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			if backoff *= 2; backoff > s.MaxBackoff {
+				backoff = s.MaxBackoff
+			}
+		}
+	}()
+}
+
+// Task runs f in the background. A crash is logged rather than taking the
+// bot down.
+func (s *Supervisor) Task(name string, f func()) {
+	s.tasks.Add(1)
+	go func() {
+		defer s.tasks.Done()
+		if err := protect(func() error { f(); return nil }); err != nil {
+			lifecycleLog.Error("task crashed", "task", name, "error", err)
+		}
+	}()
+}
+
+// Wait waits for the subsystems to stop and the tasks to finish, and
+// reports whether they did before ctx was done.
+func (s *Supervisor) Wait(ctx context.Context) bool {
+	return waitGroup(ctx, &s.subsystems) && waitGroup(ctx, &s.tasks)
+}
+
+// onDone calls f once ctx is done, unless the returned function is called
+// first.
+func onDone(ctx context.Context, f func()) func() {
+	cancel := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			f()
+		case <-cancel:
+		}
+	}()
+	return func() { close(cancel) }
+}
+
+// protect calls f, turning a panic into an error.
+func protect(f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return f()
+}
+
+// waitGroup waits for wg and reports whether it was done before ctx.
+func waitGroup(ctx context.Context, wg *sync.WaitGroup) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
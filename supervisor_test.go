@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSupervisor(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	supervisor := NewSupervisor(ctx)
+	supervisor.MinBackoff = time.Millisecond
+	supervisor.MaxBackoff = 10 * time.Millisecond
+
+	// a subsystem that crashes is restarted until it keeps running
+	var starts int32
+	running := make(chan struct{})
+	supervisor.Go("flaky", func(ctx context.Context) error {
+		switch atomic.AddInt32(&starts, 1) {
+		case 1:
+			panic("boom")
+		case 2:
+			return errors.New("connection refused")
+		case 3:
+			return nil
+		}
+		close(running)
+		<-ctx.Done()
+		return nil
+	})
+	select {
+	case <-running:
+	case <-time.After(5 * time.Second):
+		t.Fatal("subsystem was not restarted")
+	}
+	assert.Equal(t, int32(4), atomic.LoadInt32(&starts))
+
+	// a task that crashes does not take the bot down
+	finished := make(chan struct{})
+	supervisor.Task("crash", func() { panic("boom") })
+	supervisor.Task("slow", func() {
+		time.Sleep(50 * time.Millisecond)
+		close(finished)
+	})
+
+	cancel()
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer waitCancel()
+	assert.True(t, supervisor.Wait(waitCtx))
+	select {
+	case <-finished:
+	default:
+		t.Fatal("Wait did not wait for the task")
+	}
+
+	// Wait gives up at the deadline
+	supervisor.Task("stuck", func() { time.Sleep(time.Second) })
+	waitCtx, waitCancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer waitCancel()
+	assert.False(t, supervisor.Wait(waitCtx))
+}
+
+func TestProtect(t *testing.T) {
+	err := protect(func() error { panic("boom") })
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "panic: boom\n")
+	assert.EqualError(t, protect(func() error { return errors.New("failed") }), "failed")
+}
@@ -0,0 +1,183 @@
+package translate
+
+import (
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Cache memoizes translations keyed by text, language pair and backend.
+// Recently used entries are kept in memory up to a fixed capacity; when a
+// directory is given, entries are also written there so they survive a
+// restart. Entries older than the TTL are treated as misses.
+// A Cache is safe for concurrent use.
+type Cache struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	dir      string
+	ll       *list.List
+	items    map[cacheKey]*list.Element
+	hits     uint64
+	misses   uint64
+}
+
+type cacheKey struct {
+	Backend string
+	From    string
+	To      string
+	Text    string
+}
+
+type cacheEntry struct {
+	Key     cacheKey
+	Trans   string
+	Expires time.Time
+}
+
+// DefaultCache is the cache consulted by Google and Aligned and their
+// Context variants; the other translators always ask Google. Set it to nil
+// to disable caching.
+var DefaultCache = NewCache(1024, 24*time.Hour, "")
+
+// NewCache returns a cache holding at most capacity entries in memory.
+// A zero ttl keeps entries forever. If dir is not empty, entries are also
+// persisted as files under dir.
+func NewCache(capacity int, ttl time.Duration, dir string) *Cache {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			logger.Error("cache directory error", "dir", dir, "error", err)
+			dir = ""
+		}
+	}
+	return &Cache{
+		capacity: capacity,
+		ttl:      ttl,
+		dir:      dir,
+		ll:       list.New(),
+		items:    make(map[cacheKey]*list.Element),
+	}
+}
+
+// Get returns the cached translation of text from one language to another
+// produced by backend.
+func (c *Cache) Get(backend, from, to, text string) (string, bool) {
+	key := cacheKey{backend, from, to, text}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*cacheEntry)
+		if c.expired(e) {
+			c.removeElement(el)
+		} else {
+			c.ll.MoveToFront(el)
+			c.hits++
+			return e.Trans, true
+		}
+	}
+
+	if e, ok := c.load(key); ok {
+		c.add(e)
+		c.hits++
+		return e.Trans, true
+	}
+
+	c.misses++
+	return "", false
+}
+
+// Put stores a translation in the cache.
+func (c *Cache) Put(backend, from, to, text, trans string) {
+	e := &cacheEntry{Key: cacheKey{backend, from, to, text}, Trans: trans}
+	if c.ttl > 0 {
+		e.Expires = time.Now().Add(c.ttl)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[e.Key]; ok {
+		c.removeElement(el)
+	}
+	c.add(e)
+	c.store(e)
+}
+
+// Stats returns the number of cache hits and misses so far.
+func (c *Cache) Stats() (hits, misses uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+// Len returns the number of entries held in memory.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+func (c *Cache) add(e *cacheEntry) {
+	c.items[e.Key] = c.ll.PushFront(e)
+	for c.capacity > 0 && c.ll.Len() > c.capacity {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+func (c *Cache) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*cacheEntry).Key)
+}
+
+func (c *Cache) expired(e *cacheEntry) bool {
+	return !e.Expires.IsZero() && time.Now().After(e.Expires)
+}
+
+// path returns the file an entry is persisted to.
+func (c *Cache) path(key cacheKey) string {
+	h := sha1.New()
+	for _, s := range []string{key.Backend, key.From, key.To, key.Text} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return filepath.Join(c.dir, hex.EncodeToString(h.Sum(nil))+".json")
+}
+
+func (c *Cache) load(key cacheKey) (*cacheEntry, bool) {
+	if c.dir == "" {
+		return nil, false
+	}
+	data, err := ioutil.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	var e cacheEntry
+	if err = json.Unmarshal(data, &e); err != nil || e.Key != key {
+		return nil, false
+	}
+	if c.expired(&e) {
+		os.Remove(c.path(key))
+		return nil, false
+	}
+	return &e, true
+}
+
+func (c *Cache) store(e *cacheEntry) {
+	if c.dir == "" {
+		return
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		logger.Error("cache encoding error", "error", err)
+		return
+	}
+	if err = ioutil.WriteFile(c.path(e.Key), data, 0644); err != nil {
+		logger.Error("cache write error", "error", err)
+	}
+}
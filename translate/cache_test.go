@@ -0,0 +1,60 @@
+package translate
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewCache(2, 0, "")
+	c.Put("google", "en", "ja", "a", "A")
+	c.Put("google", "en", "ja", "b", "B")
+	_, _ = c.Get("google", "en", "ja", "a")
+	c.Put("google", "en", "ja", "c", "C")
+
+	_, ok := c.Get("google", "en", "ja", "b")
+	assert.False(t, ok)
+	trans, ok := c.Get("google", "en", "ja", "a")
+	assert.True(t, ok)
+	assert.Equal(t, "A", trans)
+	assert.Equal(t, 2, c.Len())
+
+	hits, misses := c.Stats()
+	assert.Equal(t, uint64(2), hits)
+	assert.Equal(t, uint64(1), misses)
+}
+
+func TestCacheKeyIncludesLanguagesAndBackend(t *testing.T) {
+	c := NewCache(10, 0, "")
+	c.Put("google", "en", "ja", "hello", "こんにちは")
+
+	_, ok := c.Get("google", "en", "ko", "hello")
+	assert.False(t, ok)
+	_, ok = c.Get("deepl", "en", "ja", "hello")
+	assert.False(t, ok)
+}
+
+func TestCacheExpires(t *testing.T) {
+	c := NewCache(10, time.Millisecond, "")
+	c.Put("google", "en", "ja", "hello", "こんにちは")
+	time.Sleep(5 * time.Millisecond)
+
+	_, ok := c.Get("google", "en", "ja", "hello")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestCachePersistsToDisk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "translate-cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	NewCache(10, time.Hour, dir).Put("google", "en", "ja", "hello", "こんにちは")
+
+	trans, ok := NewCache(10, time.Hour, dir).Get("google", "en", "ja", "hello")
+	assert.True(t, ok)
+	assert.Equal(t, "こんにちは", trans)
+}
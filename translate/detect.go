@@ -0,0 +1,154 @@
+package translate
+
+import (
+	"context"
+	"github.com/abadojack/whatlanggo"
+	"unicode"
+)
+
+// Detection is a guess of the language a text is written in.
+type Detection struct {
+	// Lang is a translator language code such as "ja", or "" if unknown.
+	Lang string
+	// Confidence ranges from 0 (no idea) to 1 (certain).
+	Confidence float64
+}
+
+// Detector guesses the language of a text.
+type Detector interface {
+	Detect(text string) Detection
+}
+
+// cjkWeight is how many Latin letters one CJK character is worth when
+// comparing the amount of text in each script; a CJK character carries
+// roughly as much as a short English word.
+const cjkWeight = 3
+
+// ScriptDetector guesses CJK languages from the scripts used in a text.
+// Kana only appear in Japanese and Hangul only in Korean, so a Japanese
+// sentence full of English terms is still recognized as Japanese.
+// Texts without CJK characters are left undetected.
+type ScriptDetector struct{}
+
+func (ScriptDetector) Detect(text string) Detection {
+	var kana, hangul, han, other int
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			kana++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.IsLetter(r):
+			other++
+		}
+	}
+
+	ratio := func(n int) float64 {
+		return float64(n*cjkWeight) / float64(n*cjkWeight+other)
+	}
+	switch {
+	case kana > 0:
+		return Detection{"ja", 0.5 + 0.5*ratio(kana+han)}
+	case hangul > 0:
+		return Detection{"ko", 0.5 + 0.5*ratio(hangul+han)}
+	case han > 0:
+		// kanji-only Japanese is indistinguishable from Chinese
+		return Detection{"zh-CN", 0.5 * ratio(han)}
+	default:
+		return Detection{}
+	}
+}
+
+// WhatlangDetector guesses with whatlanggo's trigram model. It is unreliable
+// on short texts, so its confidence grows with the length of the text.
+type WhatlangDetector struct{}
+
+// whatlangLetters is the number of letters from which whatlanggo's guess is
+// trusted fully.
+const whatlangLetters = 40
+
+func (WhatlangDetector) Detect(text string) Detection {
+	var letters int
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+	if letters == 0 {
+		return Detection{}
+	}
+
+	var lang string
+	switch whatlanggo.DetectLang(text) {
+	case whatlanggo.Jpn:
+		lang = "ja"
+	case whatlanggo.Eng:
+		lang = "en"
+	case whatlanggo.Kor:
+		lang = "ko"
+	case whatlanggo.Cmn:
+		lang = "zh-CN"
+	default:
+		return Detection{}
+	}
+
+	confidence := float64(letters) / whatlangLetters
+	if confidence > 1 {
+		confidence = 1
+	}
+	return Detection{lang, confidence}
+}
+
+// GoogleDetector asks Google Translate which language a text is in. It costs
+// a request, so it is best placed last in a ChainDetector.
+type GoogleDetector struct{}
+
+func (GoogleDetector) Detect(text string) Detection {
+	reply, err := requestGoogle(context.Background(), "auto", "en", text)
+	if err != nil {
+		logger.Error("detection error", "error", err)
+		return Detection{}
+	}
+
+	ld := reply.Ld_result
+	for i, lang := range ld.Srclangs {
+		if lang == reply.Src && i < len(ld.Srclangs_confidences) {
+			return Detection{lang, ld.Srclangs_confidences[i]}
+		}
+	}
+	if reply.Src != "" {
+		return Detection{reply.Src, 0.5}
+	}
+	return Detection{}
+}
+
+// ChainDetector consults detectors in order and returns the first detection
+// whose confidence reaches Threshold. If none does, the language is reported
+// as Fallback with zero confidence.
+type ChainDetector struct {
+	Detectors []Detector
+	Threshold float64
+	Fallback  string
+}
+
+// NewChainDetector returns the default chain: scripts, then whatlanggo, then
+// Google.
+func NewChainDetector(threshold float64, fallback string) ChainDetector {
+	return ChainDetector{
+		Detectors: []Detector{ScriptDetector{}, WhatlangDetector{}, GoogleDetector{}},
+		Threshold: threshold,
+		Fallback:  fallback,
+	}
+}
+
+func (c ChainDetector) Detect(text string) Detection {
+	for _, d := range c.Detectors {
+		detection := d.Detect(text)
+		if detection.Lang != "" && detection.Confidence >= c.Threshold {
+			return detection
+		}
+	}
+	return Detection{Lang: c.Fallback}
+}
@@ -0,0 +1,46 @@
+package translate
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestScriptDetector(t *testing.T) {
+	d := ScriptDetector{}
+
+	ja := d.Detect("このpaperのattention mechanismが面白い")
+	assert.Equal(t, "ja", ja.Lang)
+	assert.True(t, ja.Confidence > 0.6)
+
+	ko := d.Detect("이 논문 재미있네요")
+	assert.Equal(t, "ko", ko.Lang)
+	assert.True(t, ko.Confidence > 0.9)
+
+	zh := d.Detect("这篇论文很有意思")
+	assert.Equal(t, "zh-CN", zh.Lang)
+	assert.True(t, zh.Confidence <= 0.5)
+
+	assert.Equal(t, Detection{}, d.Detect("an English sentence"))
+}
+
+type fixedDetector Detection
+
+func (d fixedDetector) Detect(string) Detection {
+	return Detection(d)
+}
+
+func TestChainDetector(t *testing.T) {
+	c := ChainDetector{
+		Detectors: []Detector{
+			fixedDetector{"zh-CN", 0.4},
+			fixedDetector{"", 0.9},
+			fixedDetector{"ja", 0.7},
+		},
+		Threshold: 0.6,
+		Fallback:  "auto",
+	}
+	assert.Equal(t, Detection{"ja", 0.7}, c.Detect("漢字"))
+
+	c.Threshold = 0.8
+	assert.Equal(t, Detection{Lang: "auto"}, c.Detect("漢字"))
+}
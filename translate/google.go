@@ -15,12 +15,22 @@
 package translate
 
 import (
+	"context"
 	"encoding/json"
-	"io/ioutil"
-	"log"
-	"net/http"
+	"github.com/reiyw/paperbot/logging"
+	"github.com/reiyw/paperbot/metrics"
 	"net/url"
 	"strings"
+	"time"
+)
+
+var logger = logging.New("translate")
+
+var (
+	translationRequests = metrics.NewCounter("paperbot_translation_requests_total",
+		"Requests to the translation service, by outcome (ok, error).", "outcome")
+	translationDuration = metrics.NewHistogram("paperbot_translation_duration_seconds",
+		"How long requests to the translation service take.", metrics.DefaultBuckets)
 )
 
 type (
@@ -43,38 +53,45 @@ type (
 	}
 )
 
-//&dj=1&source=icon&oe=UTF-8
+// &dj=1&source=icon&oe=UTF-8
 const GOOGLEURL = "http://translate.google.cn/translate_a/single?client=gtx&dt=t&dj=1&ie=UTF-8"
 
 // Google using Google translation of a single character
 //
-//   From 		To  		Translation direction
-//-------------------------------------------------------------------------------
-//   auto     		auto    		Automatic Identification
-//   zh-CN       	en      		Simplified Chinese -> English
-//   zh-CN       	zh-TW      	Simplified Chinese -> traditional Chinese
-//   zh-CN       	ja-JP      		Simplified Chinese -> Japanese
+//	From 		To  		Translation direction
+//
+// -------------------------------------------------------------------------------
+//
+//	auto     		auto    		Automatic Identification
+//	zh-CN       	en      		Simplified Chinese -> English
+//	zh-CN       	zh-TW      	Simplified Chinese -> traditional Chinese
+//	zh-CN       	ja-JP      		Simplified Chinese -> Japanese
+//
+// Translations are memoized in DefaultCache.
 func Google(from, to, query string) string {
-	client := getHttpClient(0, 0)
-	//query = strings.Replace(query, " ", "%20", -1)
-	//prefix, suffix := getNumberStringPosition(query)
+	return GoogleContext(context.Background(), from, to, query)
+}
 
-	resp, err := client.Get(GOOGLEURL + "&sl=" + from + "&tl=" + to + "&q=" + url.QueryEscape(query))
-	if err != nil {
-		log.Fatalln(err)
-		return ""
+// GoogleContext is like Google but gives up when ctx is done.
+func GoogleContext(ctx context.Context, from, to, query string) string {
+	if DefaultCache == nil {
+		return google(ctx, from, to, query)
 	}
-	defer resp.Body.Close()
-
-	data, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		log.Println(err)
-		return ""
+	if trans, ok := DefaultCache.Get("google", from, to, query); ok {
+		return trans
 	}
-	var reply GoogleReply
+	trans := google(ctx, from, to, query)
+	if trans != "" {
+		DefaultCache.Put("google", from, to, query, trans)
+	}
+	return trans
+}
 
-	if err = json.Unmarshal(data, &reply); err != nil {
-		log.Println(err)
+// google requests a translation without consulting the cache.
+func google(ctx context.Context, from, to, query string) string {
+	reply, err := requestGoogle(ctx, from, to, query)
+	if err != nil {
+		logger.Error("translation error", "error", err)
 		return ""
 	}
 
@@ -86,34 +103,94 @@ func Google(from, to, query string) string {
 	return b.String()
 }
 
-// Googles using Google translation of multiple characters
+// SentencePair is a sentence and its translation.
+type SentencePair struct {
+	Orig  string
+	Trans string
+}
+
+// Aligned translates query with Google and returns each original sentence
+// paired with its translation, in order.
 //
-//   From 		To  		Translation direction
-//-------------------------------------------------------------------------------
-//   auto     		auto    		Automatic Identification
-//   zh-CN       	en      		Simplified Chinese -> English
-//   zh-CN       	zh-TW      	Simplified Chinese -> traditional Chinese
-//   zh-CN       	ja-JP      		Simplified Chinese -> Japanese
-func Googles(from, to string, querys []string) (results []string) {
-	query := strings.Join(querys, "%0A")
-	query = strings.Replace(query, " ", "%20", -1)
+// Translations are memoized in DefaultCache.
+func Aligned(from, to, query string) []SentencePair {
+	return AlignedContext(context.Background(), from, to, query)
+}
 
-	resp, err := http.Get(GOOGLEURL + "&sl=" + from + "&tl=" + to + "&q=" + query)
+// AlignedContext is like Aligned but gives up when ctx is done.
+func AlignedContext(ctx context.Context, from, to, query string) []SentencePair {
+	var pairs []SentencePair
+	if DefaultCache != nil {
+		if cached, ok := DefaultCache.Get("google-aligned", from, to, query); ok {
+			if err := json.Unmarshal([]byte(cached), &pairs); err == nil {
+				return pairs
+			}
+		}
+	}
+
+	reply, err := requestGoogle(ctx, from, to, query)
 	if err != nil {
-		log.Fatalln(err)
+		logger.Error("translation error", "error", err)
 		return nil
 	}
-	defer resp.Body.Close()
+	for _, sent := range reply.Sentences {
+		orig := strings.TrimSpace(sent.Orig)
+		if orig == "" {
+			continue
+		}
+		pairs = append(pairs, SentencePair{orig, strings.TrimSpace(sent.Trans)})
+	}
+
+	if DefaultCache != nil && len(pairs) > 0 {
+		if data, err := json.Marshal(pairs); err == nil {
+			DefaultCache.Put("google-aligned", from, to, query, string(data))
+		}
+	}
+	return pairs
+}
 
-	data, err := ioutil.ReadAll(resp.Body)
+// requestGoogle sends a single query to Google and decodes the reply.
+func requestGoogle(ctx context.Context, from, to, query string) (*GoogleReply, error) {
+	return fetchGoogle(ctx, GOOGLEURL+"&sl="+from+"&tl="+to+"&q="+url.QueryEscape(query))
+}
+
+// fetchGoogle requests rawurl with DefaultClient and decodes the reply.
+func fetchGoogle(ctx context.Context, rawurl string) (*GoogleReply, error) {
+	start := time.Now()
+	data, err := DefaultClient.Get(ctx, rawurl)
+	logger.Debug("requested translation", "duration", time.Since(start), "bytes", len(data), "error", err)
+	translationDuration.Observe(time.Since(start).Seconds())
 	if err != nil {
-		log.Println(err)
-		return nil
+		translationRequests.Inc("error")
+		return nil, err
 	}
 	var reply GoogleReply
 
 	if err = json.Unmarshal(data, &reply); err != nil {
-		log.Println(err)
+		translationRequests.Inc("error")
+		return nil, err
+	}
+	translationRequests.Inc("ok")
+	return &reply, nil
+}
+
+// Googles using Google translation of multiple characters
+//
+//	From 		To  		Translation direction
+//
+// -------------------------------------------------------------------------------
+//
+//	auto     		auto    		Automatic Identification
+//	zh-CN       	en      		Simplified Chinese -> English
+//	zh-CN       	zh-TW      	Simplified Chinese -> traditional Chinese
+//	zh-CN       	ja-JP      		Simplified Chinese -> Japanese
+func Googles(from, to string, querys []string) (results []string) {
+	query := strings.Join(querys, "%0A")
+	query = strings.Replace(query, " ", "%20", -1)
+
+	reply, err := fetchGoogle(context.Background(), GOOGLEURL+"&sl="+from+"&tl="+to+"&q="+query)
+	if err != nil {
+		logger.Error("translation error", "error", err)
 		return nil
 	}
 	for _, v := range reply.Sentences {
@@ -130,22 +207,9 @@ func ToEnglish(query string) string {
 	prefix, suffix := getNumberStringPosition(query)
 
 	//"上班时间1"和"下班时间1"都会翻译成"Working time 1",因此去除字符串前后的数值
-	resp, err := http.Get(GOOGLEURL + "&sl=auto&tl=en&q=" + query[prefix:suffix])
-	if err != nil {
-		log.Fatalln(err)
-		return ""
-	}
-	defer resp.Body.Close()
-
-	data, err := ioutil.ReadAll(resp.Body)
+	reply, err := fetchGoogle(context.Background(), GOOGLEURL+"&sl=auto&tl=en&q="+query[prefix:suffix])
 	if err != nil {
-		log.Println(err)
-		return ""
-	}
-	var reply GoogleReply
-
-	if err = json.Unmarshal(data, &reply); err != nil {
-		log.Println(err)
+		logger.Error("translation error", "error", err)
 		return ""
 	}
 	result := query[:prefix] + " " + reply.Sentences[0].Trans + " " + query[suffix:]
@@ -157,22 +221,9 @@ func ToEnglish(query string) string {
 func ToTraditional(query string) string {
 	query = strings.Replace(query, " ", "%20", -1)
 
-	resp, err := http.Get(GOOGLEURL + "&sl=auto&tl=zh-TW&q=" + query)
-	if err != nil {
-		log.Fatalln(err)
-		return ""
-	}
-	defer resp.Body.Close()
-
-	data, err := ioutil.ReadAll(resp.Body)
+	reply, err := fetchGoogle(context.Background(), GOOGLEURL+"&sl=auto&tl=zh-TW&q="+query)
 	if err != nil {
-		log.Println(err)
-		return ""
-	}
-	var reply GoogleReply
-
-	if err = json.Unmarshal(data, &reply); err != nil {
-		log.Println(err)
+		logger.Error("translation error", "error", err)
 		return ""
 	}
 	return reply.Sentences[0].Trans
@@ -182,22 +233,9 @@ func ToTraditional(query string) string {
 func ToSimplified(query string) string {
 	query = strings.Replace(query, " ", "%20", -1)
 
-	resp, err := http.Get(GOOGLEURL + "&sl=auto&tl=zh-CN&q=" + query)
+	reply, err := fetchGoogle(context.Background(), GOOGLEURL+"&sl=auto&tl=zh-CN&q="+query)
 	if err != nil {
-		log.Fatalln(err)
-		return ""
-	}
-	defer resp.Body.Close()
-
-	data, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		log.Println(err)
-		return ""
-	}
-	var reply GoogleReply
-
-	if err = json.Unmarshal(data, &reply); err != nil {
-		log.Println(err)
+		logger.Error("translation error", "error", err)
 		return ""
 	}
 	return reply.Sentences[0].Trans
@@ -15,30 +15,130 @@
 package translate
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 )
 
-// getHttpClient 获取超时设置的HTTP服务,默认连接20s,读写25s
-func getHttpClient(rw_time, connect_time time.Duration) http.Client {
-	if rw_time == 0 {
-		rw_time = 20 * time.Second
-	}
-	if connect_time == 0 {
-		connect_time = 10 * time.Second
-	}
-	return http.Client{
-		Transport: &http.Transport{
-			Dial: func(netw, addr string) (net.Conn, error) {
-				deadline := time.Now().Add(rw_time)                 //读写超时
-				c, err := net.DialTimeout(netw, addr, connect_time) //连接超时
-				if err != nil {
-					return nil, err
-				}
-				c.SetDeadline(deadline)
-				return c, nil
-			},
-		},
+// Client sends translation requests. It holds one http.Client so that
+// connections are pooled and kept alive across calls; each request is bound
+// by its own timeout instead of a deadline on the connection.
+type Client struct {
+	HTTP *http.Client
+	// Timeout bounds a single attempt.
+	Timeout time.Duration
+	// MaxRetries is how many times a request failing with 429, 5xx or a
+	// network error is retried.
+	MaxRetries int
+	// Backoff is the wait before the first retry, doubled on each retry.
+	Backoff time.Duration
+}
+
+// DefaultClient is used by Google and the other translators.
+var DefaultClient = NewClient(25*time.Second, nil)
+
+// NewClient returns a client whose attempts time out after timeout. Requests
+// go through proxy if given, or the proxy set in the environment otherwise.
+func NewClient(timeout time.Duration, proxy *url.URL) *Client {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	if proxy != nil {
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	return &Client{
+		HTTP:       &http.Client{Transport: transport},
+		Timeout:    timeout,
+		MaxRetries: 3,
+		Backoff:    500 * time.Millisecond,
+	}
+}
+
+// StatusError is returned when the server answers with a non-200 status.
+type StatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status code error: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+func (e *StatusError) retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// Get fetches rawurl and returns the response body, retrying with
+// exponential backoff on rate limiting, server errors and network errors.
+func (c *Client) Get(ctx context.Context, rawurl string) ([]byte, error) {
+	req, err := http.NewRequest("GET", rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	backoff := c.Backoff
+	for attempt := 0; ; attempt++ {
+		data, err := c.do(ctx, req)
+		if err == nil {
+			return data, nil
+		}
+		if attempt >= c.MaxRetries || ctx.Err() != nil {
+			return nil, err
+		}
+
+		wait := backoff
+		if e, ok := err.(*StatusError); ok {
+			if !e.retryable() {
+				return nil, err
+			}
+			if e.RetryAfter > wait {
+				wait = e.RetryAfter
+			}
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// do makes a single attempt.
+func (c *Client) do(ctx context.Context, req *http.Request) ([]byte, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	resp, err := c.HTTP.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		e := &StatusError{StatusCode: resp.StatusCode}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			e.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return nil, e
 	}
+	return ioutil.ReadAll(resp.Body)
 }
@@ -0,0 +1,64 @@
+package translate
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientRetriesServerErrors(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch calls {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(time.Second, nil)
+	c.Backoff = time.Millisecond
+	data, err := c.Get(context.Background(), server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", string(data))
+	assert.Equal(t, 3, calls)
+}
+
+func TestClientDoesNotRetryClientErrors(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	c := NewClient(time.Second, nil)
+	c.Backoff = time.Millisecond
+	_, err := c.Get(context.Background(), server.URL)
+	assert.Equal(t, &StatusError{StatusCode: http.StatusBadRequest}, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestClientTimesOutEachAttempt(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	c := NewClient(10*time.Millisecond, nil)
+	c.MaxRetries = 1
+	c.Backoff = time.Millisecond
+	start := time.Now()
+	_, err := c.Get(context.Background(), server.URL)
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < time.Second)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// TrendModeNew posts only papers that were not on the previous list.
+	TrendModeNew = "new"
+	// TrendModeMovers also posts papers whose rank changed a lot.
+	TrendModeMovers = "movers"
+	// TrendModeFull posts the whole list every time.
+	TrendModeFull = "full"
+)
+
+func isTrendMode(mode string) bool {
+	return mode == TrendModeNew || mode == TrendModeMovers || mode == TrendModeFull
+}
+
+// trendMoverThreshold is the rank change from which a paper counts as a
+// mover.
+const trendMoverThreshold = 3
+
+// trendHistoryRetention is how long a paper that left the list is
+// remembered.
+const trendHistoryRetention = 30 * 24 * time.Hour
+
+// TrendChange describes how a paper's position differs from the previous
+// list posted to a channel.
+type TrendChange struct {
+	Rank int
+	// PreviousRank is 0 if the paper was not on the previous list.
+	PreviousRank int
+	// Days is the number of days the paper has been on the list in a row.
+	Days int
+}
+
+func (c TrendChange) New() bool {
+	return c.PreviousRank == 0
+}
+
+// Moved returns the number of ranks the paper went up (positive) or down
+// (negative).
+func (c TrendChange) Moved() int {
+	if c.New() {
+		return 0
+	}
+	return c.PreviousRank - c.Rank
+}
+
+// Shown reports whether the paper should be posted in mode.
+func (c TrendChange) Shown(mode string) bool {
+	switch mode {
+	case TrendModeNew:
+		return c.New()
+	case TrendModeMovers:
+		moved := c.Moved()
+		return c.New() || moved >= trendMoverThreshold || moved <= -trendMoverThreshold
+	default:
+		return true
+	}
+}
+
+// TrendHistory remembers the trending lists posted to each channel.
+type TrendHistory struct {
+	store    *Store
+	mu       sync.Mutex
+	channels map[string]*channelTrendHistory
+}
+
+type channelTrendHistory struct {
+	LastRun time.Time
+	Papers  map[string]*trendRecord
+}
+
+type trendRecord struct {
+	// Id and Url identify the paper as TrendingPaper does.
+	Id  string `json:",omitempty"`
+	Url string `json:",omitempty"`
+	// Since is when the paper's current stay on the list began.
+	Since    time.Time
+	LastSeen time.Time
+	LastRank int
+	Days     int
+	// Ranks holds the best rank on each day of the past week, by date.
+	Ranks map[string]int `json:",omitempty"`
+}
+
+// trendWeek is the period summarized by the weekly digest.
+const trendWeek = 7 * 24 * time.Hour
+
+// WeeklyTrend summarizes a paper's days on a channel's list in the past week.
+type WeeklyTrend struct {
+	Paper TrendingPaper
+	// Days is the number of days the paper was on the list.
+	Days     int
+	BestRank int
+}
+
+func NewTrendHistory(store *Store) (*TrendHistory, error) {
+	h := &TrendHistory{store: store, channels: map[string]*channelTrendHistory{}}
+	if err := store.Load("trend_history", &h.channels); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Record stores the ranked papers as the list posted to channel at now and
+// returns how each paper changed since the previous list.
+func (h *TrendHistory) Record(channel string, papers []TrendingPaper, now time.Time) ([]TrendChange, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch, ok := h.channels[channel]
+	if !ok {
+		ch = &channelTrendHistory{Papers: map[string]*trendRecord{}}
+		h.channels[channel] = ch
+	}
+
+	var changes []TrendChange
+	for i, tp := range papers {
+		rank := i + 1
+		r, ok := ch.Papers[tp.CanonicalId()]
+		// a paper missing from the previous list starts a new stay
+		if !ok || !r.LastSeen.Equal(ch.LastRun) {
+			r = &trendRecord{Since: now}
+			ch.Papers[tp.CanonicalId()] = r
+		}
+		if r.Days == 0 || !sameDay(r.LastSeen, now) {
+			r.Days++
+		}
+		changes = append(changes, TrendChange{Rank: rank, PreviousRank: r.LastRank, Days: r.Days})
+		r.Id, r.Url = tp.Id, tp.Url
+		r.LastSeen = now
+		r.LastRank = rank
+		if r.Ranks == nil {
+			r.Ranks = map[string]int{}
+		}
+		date := now.Format("2006-01-02")
+		if best, ok := r.Ranks[date]; !ok || rank < best {
+			r.Ranks[date] = rank
+		}
+	}
+
+	for id, r := range ch.Papers {
+		if !r.LastSeen.Equal(now) {
+			r.LastRank = 0
+		}
+		if now.Sub(r.LastSeen) > trendHistoryRetention {
+			delete(ch.Papers, id)
+		}
+		for date := range r.Ranks {
+			if t, err := time.ParseInLocation("2006-01-02", date, now.Location()); err != nil || now.Sub(t) > trendWeek {
+				delete(r.Ranks, date)
+			}
+		}
+	}
+	ch.LastRun = now
+
+	return changes, h.store.Save("trend_history", h.channels)
+}
+
+// Changes returns how each of the ranked papers changed since the previous
+// list posted to channel, as Record would at now, without recording them.
+func (h *TrendHistory) Changes(channel string, papers []TrendingPaper, now time.Time) []TrendChange {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := h.channels[channel]
+	var changes []TrendChange
+	for i, tp := range papers {
+		c := TrendChange{Rank: i + 1, Days: 1}
+		if ch != nil {
+			if r, ok := ch.Papers[tp.CanonicalId()]; ok && r.LastSeen.Equal(ch.LastRun) {
+				c.PreviousRank = r.LastRank
+				c.Days = r.Days
+				if !sameDay(r.LastSeen, now) {
+					c.Days++
+				}
+			}
+		}
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+// Week returns the papers on channel's lists in the week before now, those
+// on the list for the most days first.
+func (h *TrendHistory) Week(channel string, now time.Time) []WeeklyTrend {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch, ok := h.channels[channel]
+	if !ok {
+		return nil
+	}
+	var trends []WeeklyTrend
+	for _, r := range ch.Papers {
+		w := WeeklyTrend{Paper: TrendingPaper{Id: r.Id, Url: r.Url}}
+		for date, rank := range r.Ranks {
+			t, err := time.ParseInLocation("2006-01-02", date, now.Location())
+			if err != nil || now.Sub(t) > trendWeek {
+				continue
+			}
+			w.Days++
+			if w.BestRank == 0 || rank < w.BestRank {
+				w.BestRank = rank
+			}
+		}
+		// records from before Id was kept cannot be fetched
+		if w.Days > 0 && r.Id != "" {
+			trends = append(trends, w)
+		}
+	}
+	sort.Slice(trends, func(i, j int) bool {
+		if trends[i].Days != trends[j].Days {
+			return trends[i].Days > trends[j].Days
+		}
+		if trends[i].BestRank != trends[j].BestRank {
+			return trends[i].BestRank < trends[j].BestRank
+		}
+		return trends[i].Paper.CanonicalId() < trends[j].Paper.CanonicalId()
+	})
+	return trends
+}
+
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTrendHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "paperbot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store, err := NewStore(dir)
+	assert.NoError(t, err)
+	history, err := NewTrendHistory(store)
+	assert.NoError(t, err)
+
+	ranking := func(ids ...string) []TrendingPaper {
+		var papers []TrendingPaper
+		for _, id := range ids {
+			papers = append(papers, TrendingPaper{Id: id})
+		}
+		return papers
+	}
+	day1 := time.Date(2018, 11, 5, 12, 0, 0, 0, time.UTC)
+
+	changes, err := history.Record("C1", ranking("a", "b", "c", "d"), day1)
+	assert.NoError(t, err)
+	assert.Equal(t, []TrendChange{{1, 0, 1}, {2, 0, 1}, {3, 0, 1}, {4, 0, 1}}, changes)
+
+	// the history survives a restart
+	history, err = NewTrendHistory(store)
+	assert.NoError(t, err)
+
+	// changes can be looked at without recording them
+	assert.Equal(t, []TrendChange{{1, 4, 2}, {2, 0, 1}}, history.Changes("C1", ranking("d", "e"), day1.AddDate(0, 0, 1)))
+	assert.Equal(t, []TrendChange{{1, 0, 1}}, history.Changes("C9", ranking("d"), day1))
+
+	changes, err = history.Record("C1", ranking("d", "a", "e", "b"), day1.AddDate(0, 0, 1))
+	assert.NoError(t, err)
+	assert.Equal(t, []TrendChange{{1, 4, 2}, {2, 1, 2}, {3, 0, 1}, {4, 2, 2}}, changes)
+	assert.True(t, changes[0].Shown(TrendModeMovers))
+	assert.False(t, changes[0].Shown(TrendModeNew))
+	assert.False(t, changes[1].Shown(TrendModeMovers))
+	assert.True(t, changes[2].Shown(TrendModeNew))
+	assert.True(t, changes[3].Shown(TrendModeFull))
+
+	// "c" left the list, so it is new again when it comes back
+	changes, err = history.Record("C1", ranking("c", "d"), day1.AddDate(0, 0, 2))
+	assert.NoError(t, err)
+	assert.Equal(t, []TrendChange{{1, 0, 1}, {2, 1, 3}}, changes)
+
+	// channels are independent and a second run on the same day is not a new day
+	changes, err = history.Record("C2", ranking("c"), day1.AddDate(0, 0, 2))
+	assert.NoError(t, err)
+	assert.Equal(t, []TrendChange{{1, 0, 1}}, changes)
+	changes, err = history.Record("C2", ranking("c"), day1.AddDate(0, 0, 2).Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, []TrendChange{{1, 1, 1}}, changes)
+}
+
+func TestTrendHistoryWeek(t *testing.T) {
+	dir, err := ioutil.TempDir("", "paperbot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store, err := NewStore(dir)
+	assert.NoError(t, err)
+	history, err := NewTrendHistory(store)
+	assert.NoError(t, err)
+
+	day1 := time.Date(2018, 11, 5, 12, 0, 0, 0, time.UTC)
+	lists := [][]TrendingPaper{
+		{{Id: "a"}, {Id: "b"}},
+		{{Id: "b"}, {Id: "c"}},
+		{{Id: "c"}, {Id: "b"}},
+	}
+	for i, list := range lists {
+		_, err := history.Record("C1", list, day1.AddDate(0, 0, i))
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []WeeklyTrend{
+		{Paper: TrendingPaper{Id: "b"}, Days: 3, BestRank: 1},
+		{Paper: TrendingPaper{Id: "c"}, Days: 2, BestRank: 1},
+		{Paper: TrendingPaper{Id: "a"}, Days: 1, BestRank: 1},
+	}, history.Week("C1", day1.AddDate(0, 0, 2)))
+
+	// a week later only the last day is left
+	assert.Equal(t, []WeeklyTrend{
+		{Paper: TrendingPaper{Id: "c"}, Days: 1, BestRank: 1},
+		{Paper: TrendingPaper{Id: "b"}, Days: 1, BestRank: 2},
+	}, history.Week("C1", day1.AddDate(0, 0, 8)))
+	assert.Empty(t, history.Week("C2", day1))
+}
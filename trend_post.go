@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// trendCandidates is how many times the limit of trending papers are
+// considered, so that filtered channels still get a full list.
+const trendCandidates = 3
+
+// trendPoster posts trending papers to every subscribed channel, filtered
+// and laid out as each channel prefers.
+type trendPoster struct {
+	Source   TrendSource
+	Limit    int
+	Settings *ChannelSettings
+	History  *TrendHistory
+	// DefaultChannel always receives the unfiltered list.
+	DefaultChannel string
+	// Send posts text to channel; details of the papers in it are expected
+	// to follow in its thread.
+	Send func(channel, text string)
+	// Subscribers, if set, are notified of trending papers they follow,
+	// whether or not any channel shows them.
+	Subscribers *UserSubscriptions
+	// Pool, if set, fetches papers within its per-host limits.
+	Pool *FetchPool
+}
+
+// PostAll posts to every subscribed channel.
+func (t *trendPoster) PostAll() {
+	subs := t.Settings.TrendSubscriptions()
+	if _, ok := subs[t.DefaultChannel]; !ok && t.DefaultChannel != "" {
+		subs[t.DefaultChannel] = TrendSubscription{}
+	}
+	if len(subs) == 0 {
+		return
+	}
+	ranking, err := t.ranking()
+	if err != nil {
+		trendLog.Error("trend source error", "error", err)
+		trendingRuns.Inc("error")
+		return
+	}
+	trendingRuns.Inc("ok")
+	fetch := t.fetcher()
+	for channel, sub := range subs {
+		t.post(channel, sub, ranking, fetch, true)
+	}
+	t.notify(ranking, fetch)
+}
+
+// PostWeekly posts to every subscribed channel the papers that were on its
+// lists for the most days in the past week.
+func (t *trendPoster) PostWeekly() {
+	subs := t.Settings.TrendSubscriptions()
+	if _, ok := subs[t.DefaultChannel]; !ok && t.DefaultChannel != "" {
+		subs[t.DefaultChannel] = TrendSubscription{}
+	}
+	fetch := t.fetcher()
+	now := time.Now()
+	for channel := range subs {
+		var entries []weeklyEntry
+		for _, w := range t.History.Week(channel, now) {
+			if len(entries) == t.Limit {
+				break
+			}
+			p, err := fetch(w.Paper)
+			if err != nil {
+				fetchLog.Warn("request error", "error", err)
+				continue
+			}
+			entries = append(entries, weeklyEntry{Trend: w, Paper: *p})
+		}
+		if len(entries) > 0 {
+			t.Send(channel, formatWeeklyDigest(entries))
+		}
+	}
+}
+
+// Post posts to channel with its subscription, or unfiltered if it has none.
+// It is run on request, so the list is compared with the last scheduled
+// post but not recorded: the next scheduled post still shows what is new.
+func (t *trendPoster) Post(channel string) {
+	ranking, err := t.ranking()
+	if err != nil {
+		trendLog.Error("trend source error", "error", err)
+		trendingRuns.Inc("error")
+		return
+	}
+	trendingRuns.Inc("ok")
+	sub, _ := t.Settings.TrendSubscription(channel)
+	fetch := t.fetcher()
+	t.post(channel, sub, ranking, fetch, false)
+	t.notify(ranking, fetch)
+}
+
+// notify matches the top of the unfiltered ranking against the subscribers.
+func (t *trendPoster) notify(ranking []TrendingPaper, fetch func(TrendingPaper) (*Paper, error)) {
+	if t.Subscribers == nil {
+		return
+	}
+	var papers []Paper
+	for i, tp := range ranking {
+		if i == t.Limit {
+			break
+		}
+		p, err := fetch(tp)
+		if err != nil {
+			continue
+		}
+		papers = append(papers, *p)
+	}
+	t.Subscribers.Match("trending", papers, "")
+}
+
+func (t *trendPoster) ranking() ([]TrendingPaper, error) {
+	if t.Source == nil {
+		return nil, fmt.Errorf("no trend source")
+	}
+	ranking, err := t.Source.Trending()
+	if err != nil {
+		return nil, err
+	}
+	if len(ranking) > t.Limit*trendCandidates {
+		ranking = ranking[:t.Limit*trendCandidates]
+	}
+	return ranking, nil
+}
+
+// fetcher returns a function fetching papers at most once per run.
+func (t *trendPoster) fetcher() func(TrendingPaper) (*Paper, error) {
+	fetched := map[string]*Paper{}
+	return func(tp TrendingPaper) (*Paper, error) {
+		if p, ok := fetched[tp.CanonicalId()]; ok {
+			return p, nil
+		}
+		var p *Paper
+		var err error
+		if t.Pool != nil {
+			p, err = t.Pool.Fetch(tp.PaperUrl())
+		} else {
+			p, err = tp.Fetch()
+		}
+		if err != nil {
+			return nil, err
+		}
+		fetched[tp.CanonicalId()] = p
+		return p, nil
+	}
+}
+
+// post posts the papers of ranking that channel shows, and records them in
+// the history if record is set.
+func (t *trendPoster) post(channel string, sub TrendSubscription, ranking []TrendingPaper, fetch func(TrendingPaper) (*Paper, error), record bool) {
+	var matched []trendEntry
+	for _, tp := range ranking {
+		if len(matched) == t.Limit {
+			break
+		}
+		p, err := fetch(tp)
+		if err != nil {
+			fetchLog.Warn("request error", "error", err)
+			continue
+		}
+		if sub.Matches(tp, *p) {
+			matched = append(matched, trendEntry{Trend: tp, Paper: *p})
+		}
+	}
+
+	var papers []TrendingPaper
+	for _, e := range matched {
+		papers = append(papers, e.Trend)
+	}
+	var changes []TrendChange
+	if record {
+		var err error
+		changes, err = t.History.Record(channel, papers, time.Now())
+		if err != nil {
+			storeLog.Error("store error", "error", err)
+		}
+	} else {
+		changes = t.History.Changes(channel, papers, time.Now())
+	}
+	mode := t.Settings.TrendMode(channel)
+	var entries []trendEntry
+	for i, e := range matched {
+		e.Change = changes[i]
+		if e.Change.Shown(mode) {
+			entries = append(entries, e)
+		}
+	}
+	if len(entries) == 0 {
+		// a scheduled post with nothing new is skipped quietly
+		if !record {
+			t.Send(channel, "No new trending papers.")
+		}
+		return
+	}
+
+	switch t.Settings.TrendLayout(channel) {
+	case TrendLayoutIndividual:
+		for _, e := range entries {
+			t.Send(channel, formatTrendEntry(e))
+		}
+	default:
+		// the details of every paper go to the digest's thread
+		t.Send(channel, formatTrendDigest(entries))
+	}
+}
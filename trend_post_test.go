@@ -0,0 +1,55 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+type staticTrendSource []TrendingPaper
+
+func (s staticTrendSource) Name() string { return "static" }
+
+func (s staticTrendSource) Trending() ([]TrendingPaper, error) { return s, nil }
+
+func TestTrendPoster(t *testing.T) {
+	dir, err := ioutil.TempDir("", "paperbot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store, err := NewStore(dir)
+	assert.NoError(t, err)
+	settings, err := NewChannelSettings(store, TrendLayoutDigest, TrendModeNew)
+	assert.NoError(t, err)
+	history, err := NewTrendHistory(store)
+	assert.NoError(t, err)
+
+	var sent []string
+	trending := &trendPoster{
+		Source:         staticTrendSource{{Id: "1805.09547"}, {Id: "1805.00001"}},
+		Limit:          10,
+		Settings:       settings,
+		History:        history,
+		DefaultChannel: "C1",
+		Send:           func(channel, text string) { sent = append(sent, channel+": "+text) },
+		Pool: NewFetchPool(1, nil, func(rawurl string) (*Paper, error) {
+			return &Paper{Title: rawurl, AbstUrl: rawurl, Year: 2018}, nil
+		}),
+	}
+
+	// posting on request does not use up what is new for the scheduled post
+	trending.Post("C1")
+	trending.Post("C1")
+	assert.Len(t, sent, 2)
+	assert.Equal(t, sent[0], sent[1])
+	assert.Contains(t, sent[0], "2. [")
+	trending.PostAll()
+	assert.Len(t, sent, 3)
+	assert.Equal(t, sent[0], sent[2])
+
+	// once posted, nothing is new, which is said on request only
+	trending.PostAll()
+	assert.Len(t, sent, 3)
+	trending.Post("C1")
+	assert.Equal(t, []string{"C1: No new trending papers."}, sent[3:])
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TrendSubscription selects which trending papers a channel receives.
+// Empty fields do not filter.
+type TrendSubscription struct {
+	// Categories are arXiv categories such as "cs.CL"; an archive such as
+	// "cs" matches all of its categories.
+	Categories []string `json:",omitempty"`
+	// Include requires at least one keyword in the title or abstract.
+	Include []string `json:",omitempty"`
+	// Exclude drops papers with any keyword in the title or abstract.
+	Exclude []string `json:",omitempty"`
+	// MinScore drops papers scoring less, in the units of the trend source.
+	MinScore float64 `json:",omitempty"`
+}
+
+// Matches reports whether the trending paper tp, whose metadata is p, is
+// wanted by the subscription.
+func (s TrendSubscription) Matches(tp TrendingPaper, p Paper) bool {
+	if tp.Score < s.MinScore {
+		return false
+	}
+	if len(s.Categories) > 0 && !matchesCategory(s.Categories, p.Categories) {
+		return false
+	}
+	text := strings.ToLower(p.Title + " " + p.AbstText)
+	if len(s.Include) > 0 && !containsAny(text, s.Include) {
+		return false
+	}
+	return !containsAny(text, s.Exclude)
+}
+
+func (s TrendSubscription) String() string {
+	var parts []string
+	if len(s.Categories) > 0 {
+		parts = append(parts, "categories: "+strings.Join(s.Categories, ", "))
+	}
+	if len(s.Include) > 0 {
+		parts = append(parts, "include: "+strings.Join(quoteAll(s.Include), ", "))
+	}
+	if len(s.Exclude) > 0 {
+		parts = append(parts, "exclude: "+strings.Join(quoteAll(s.Exclude), ", "))
+	}
+	if s.MinScore > 0 {
+		parts = append(parts, fmt.Sprintf("min score: %g", s.MinScore))
+	}
+	if len(parts) == 0 {
+		return "all papers"
+	}
+	return strings.Join(parts, "; ")
+}
+
+func matchesCategory(wanted, categories []string) bool {
+	for _, w := range wanted {
+		for _, c := range categories {
+			if strings.EqualFold(c, w) || strings.HasPrefix(strings.ToLower(c), strings.ToLower(w)+".") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// containsAny reports whether lowered text contains any of keywords,
+// ignoring case.
+func containsAny(text string, keywords []string) bool {
+	for _, k := range keywords {
+		if strings.Contains(text, strings.ToLower(k)) {
+			return true
+		}
+	}
+	return false
+}
+
+func quoteAll(ss []string) []string {
+	var quoted []string
+	for _, s := range ss {
+		quoted = append(quoted, fmt.Sprintf("%q", s))
+	}
+	return quoted
+}
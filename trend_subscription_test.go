@@ -0,0 +1,26 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTrendSubscriptionMatches(t *testing.T) {
+	tp := TrendingPaper{Id: "1805.09547", Score: 120}
+	p := Paper{
+		Title:      "Interpretable and Compositional Relation Learning by Joint Training with an Autoencoder",
+		AbstText:   "Embedding models for entities and relations are extremely useful for recovering missing facts in a knowledge base.",
+		Categories: []string{"cs.CL", "cs.AI", "cs.LG"},
+	}
+
+	assert.True(t, TrendSubscription{}.Matches(tp, p))
+	assert.True(t, TrendSubscription{Categories: []string{"stat.ML", "cs.LG"}}.Matches(tp, p))
+	assert.True(t, TrendSubscription{Categories: []string{"cs"}}.Matches(tp, p))
+	assert.False(t, TrendSubscription{Categories: []string{"cs.CV"}}.Matches(tp, p))
+	assert.False(t, TrendSubscription{Categories: []string{"c"}}.Matches(tp, p))
+	assert.True(t, TrendSubscription{Include: []string{"Knowledge Base", "graph"}}.Matches(tp, p))
+	assert.False(t, TrendSubscription{Include: []string{"knowledge graph"}}.Matches(tp, p))
+	assert.False(t, TrendSubscription{Exclude: []string{"autoencoder"}}.Matches(tp, p))
+	assert.True(t, TrendSubscription{MinScore: 120}.Matches(tp, p))
+	assert.False(t, TrendSubscription{MinScore: 121}.Matches(tp, p))
+}
@@ -1,78 +1,172 @@
 package main
 
 import (
-	"context"
-	"github.com/PuerkitoBio/goquery"
-	"github.com/chromedp/chromedp"
-	"github.com/chromedp/chromedp/runner"
-	"log"
-	"strconv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
 	"strings"
+	"time"
 )
 
+// trendWindow is how far back discussion-based sources look.
+const trendWindow = 7 * 24 * time.Hour
+
 type TrendingPaper struct {
-	Id         string
-	TweetCount int
+	// Id is an arXiv ID, used to fetch the paper unless Url is set.
+	Id string
+	// Score ranks papers within a source; higher is more popular.
+	Score float64
+	// Reason explains the score to readers, e.g. "120 tweets".
+	Reason string
+	// Url is the paper's URL, for papers not identified by an arXiv ID.
+	Url string
+	// DiscussionUrl links to where the paper is being discussed, if any.
+	DiscussionUrl string
+	// Evidence holds the entries of each source a merged paper came from.
+	Evidence []TrendingPaper
 }
 
-func RequestTrendingPapersOnArxiv() []TrendingPaper {
-	var err error
+// CanonicalId returns the key under which the same paper from different
+// sources is merged.
+func (tp TrendingPaper) CanonicalId() string {
+	if tp.Url != "" {
+		return tp.Id
+	}
+	return "arxiv:" + arxivVersion.ReplaceAllString(tp.Id, "")
+}
 
-	// create context
-	ctxt, cancel := context.WithCancel(context.Background())
-	defer cancel()
+// PaperUrl returns the URL the metadata of the paper is fetched from.
+func (tp TrendingPaper) PaperUrl() string {
+	if tp.Url != "" {
+		return tp.Url
+	}
+	return "https://arxiv.org/abs/" + tp.Id
+}
 
-	// create chrome instance
-	c, err := chromedp.New(ctxt, chromedp.WithRunnerOptions(
-		runner.Flag("headless", true),
-		runner.Flag("disable-gpu", true)))
-	if err != nil {
-		log.Fatal(err)
+// Fetch retrieves the metadata of the paper.
+func (tp TrendingPaper) Fetch() (*Paper, error) {
+	if tp.Url != "" {
+		return Request(tp.Url)
 	}
+	return FromArxivId(tp.Id)
+}
 
-	// run task list
-	var res string
-	err = c.Run(ctxt, requestBody(&res))
+// trendingPaperFromUrl returns a trending paper for a link found in a
+// discussion, or false if the link is not to a paper we support.
+func trendingPaperFromUrl(rawurl string) (TrendingPaper, bool) {
+	id, err := CanonicalId(rawurl)
 	if err != nil {
-		log.Fatal(err)
+		return TrendingPaper{}, false
+	}
+	if strings.HasPrefix(id, "arxiv:") {
+		return TrendingPaper{Id: strings.TrimPrefix(id, "arxiv:")}, true
+	}
+	return TrendingPaper{Id: id, Url: rawurl}, true
+}
+
+// keepBestPerPaper removes repeated papers, keeping the entry with the
+// highest score.
+func keepBestPerPaper(papers []TrendingPaper) []TrendingPaper {
+	best := map[string]int{}
+	var kept []TrendingPaper
+	for _, tp := range papers {
+		if i, ok := best[tp.Id]; ok {
+			if tp.Score > kept[i].Score {
+				kept[i] = tp
+			}
+			continue
+		}
+		best[tp.Id] = len(kept)
+		kept = append(kept, tp)
+	}
+	return kept
+}
+
+// TrendSource provides papers ranked by how much attention they receive,
+// most popular first.
+type TrendSource interface {
+	Name() string
+	Trending() ([]TrendingPaper, error)
+}
+
+// newTrendSource returns the source called name.
+func newTrendSource(name string, feedUrl string) (TrendSource, error) {
+	switch name {
+	case "huggingface":
+		return &HuggingFaceTrendSource{}, nil
+	case "hackernews":
+		return &HackerNewsTrendSource{Window: trendWindow}, nil
+	case "reddit":
+		return &RedditTrendSource{Subreddit: "MachineLearning", Window: trendWindow}, nil
+	case "feed":
+		if feedUrl == "" {
+			return nil, fmt.Errorf("trend source feed requires a feed URL")
+		}
+		return &FeedTrendSource{Url: feedUrl}, nil
+	default:
+		return nil, fmt.Errorf("unknown trend source: %q", name)
 	}
+}
 
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(res))
+var trendClient = &http.Client{Timeout: 30 * time.Second}
+
+// getJSON fetches rawurl and decodes the JSON response into v.
+func getJSON(rawurl string, v interface{}) error {
+	req, err := http.NewRequest("GET", rawurl, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "paperbot (+https://github.com/reiyw/paperbot)")
+	res, err := trendClient.Do(req)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return fmt.Errorf("status code error: %d %s", res.StatusCode, res.Status)
 	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
 
-	var ids []string
-	doc.Find(".apaper").Each(func(_ int, s *goquery.Selection) {
-		id, _ := s.Attr("id")
-		ids = append(ids, id)
-	})
+// FeedTrendSource reads trending papers from a JSON feed of the form
+//
+//	[{"id": "1805.09547", "score": 120, "reason": "120 tweets"}, ...]
+//
+// which makes it easy to plug in lists produced by other tools.
+type FeedTrendSource struct {
+	Url string
+}
 
-	var tweetcounts []int
-	doc.Find(".tweetcount").Each(func(_ int, s *goquery.Selection) {
-		countStr := strings.Split(s.Text(), " ")[0]
-		count, _ := strconv.ParseInt(countStr, 10, 32)
-		tweetcounts = append(tweetcounts, int(count))
-	})
+func (s *FeedTrendSource) Name() string {
+	return "feed"
+}
 
-	var min int
-	if len(ids) < len(tweetcounts) {
-		min = len(ids)
-	} else {
-		min = len(tweetcounts)
+func (s *FeedTrendSource) Trending() ([]TrendingPaper, error) {
+	var entries []struct {
+		Id     string  `json:"id"`
+		Score  float64 `json:"score"`
+		Reason string  `json:"reason"`
+	}
+	if err := getJSON(s.Url, &entries); err != nil {
+		return nil, err
 	}
 
 	var papers []TrendingPaper
-	for i := 0; i < min; i++ {
-		papers = append(papers, TrendingPaper{ids[i], tweetcounts[i]})
+	for _, e := range entries {
+		if e.Id == "" {
+			continue
+		}
+		papers = append(papers, TrendingPaper{Id: e.Id, Score: e.Score, Reason: e.Reason})
 	}
-
-	return papers
+	sortTrendingPapers(papers)
+	return papers, nil
 }
 
-func requestBody(res *string) chromedp.Tasks {
-	return chromedp.Tasks{
-		chromedp.Navigate("http://www.arxiv-sanity.com/toptwtr"),
-		chromedp.InnerHTML("//body", res),
-	}
+// sortTrendingPapers orders papers by descending score, keeping the original
+// order among ties.
+func sortTrendingPapers(papers []TrendingPaper) {
+	sort.SliceStable(papers, func(i, j int) bool {
+		return papers[i].Score > papers[j].Score
+	})
 }
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// WeightedTrendSource is a source whose normalized scores are multiplied by
+// Weight when aggregated.
+type WeightedTrendSource struct {
+	Source TrendSource
+	Weight float64
+}
+
+// AggregateTrendSource merges several sources into one ranking. Papers are
+// deduplicated by canonical ID; each source's scores are normalized so that
+// its top paper scores 1, and a paper's score is the weighted sum over the
+// sources it appears in. The per-source entries are kept as its Evidence.
+type AggregateTrendSource struct {
+	Sources []WeightedTrendSource
+}
+
+func (a *AggregateTrendSource) Name() string {
+	var names []string
+	for _, s := range a.Sources {
+		names = append(names, s.Source.Name())
+	}
+	return strings.Join(names, "+")
+}
+
+// Trending fails only if every source fails; failures of some sources are
+// logged and the others are still merged.
+func (a *AggregateTrendSource) Trending() ([]TrendingPaper, error) {
+	index := map[string]int{}
+	var merged []TrendingPaper
+	var lastErr error
+	succeeded := 0
+
+	for _, ws := range a.Sources {
+		papers, err := ws.Source.Trending()
+		if err != nil {
+			trendLog.Error("trend source error", "source", ws.Source.Name(), "error", err)
+			lastErr = err
+			continue
+		}
+		succeeded++
+
+		var max float64
+		for _, tp := range papers {
+			if tp.Score > max {
+				max = tp.Score
+			}
+		}
+		for _, tp := range papers {
+			var score float64
+			if max > 0 {
+				score = ws.Weight * tp.Score / max
+			}
+			key := tp.CanonicalId()
+			i, ok := index[key]
+			if !ok {
+				i = len(merged)
+				index[key] = i
+				merged = append(merged, TrendingPaper{Id: tp.Id, Url: tp.Url})
+			}
+			merged[i].Score += score
+			merged[i].Evidence = append(merged[i].Evidence, tp)
+		}
+	}
+	if succeeded == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+
+	for i := range merged {
+		var reasons []string
+		for _, e := range merged[i].Evidence {
+			reasons = append(reasons, e.Reason)
+		}
+		merged[i].Reason = strings.Join(reasons, ", ")
+	}
+	sortTrendingPapers(merged)
+	return merged, nil
+}
+
+// parseTrendSources builds the source described by spec, a comma-separated
+// list of source names each optionally followed by a weight, e.g.
+// "huggingface:1,hackernews:0.5". A single source is returned as is.
+func parseTrendSources(spec string, feedUrl string) (TrendSource, error) {
+	var sources []WeightedTrendSource
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		split := strings.SplitN(item, ":", 2)
+		weight := 1.0
+		if len(split) == 2 {
+			var err error
+			weight, err = strconv.ParseFloat(split[1], 64)
+			if err != nil || weight < 0 {
+				return nil, fmt.Errorf("invalid weight of trend source %s: %q", split[0], split[1])
+			}
+		}
+		source, err := newTrendSource(split[0], feedUrl)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, WeightedTrendSource{source, weight})
+	}
+
+	switch len(sources) {
+	case 0:
+		return nil, fmt.Errorf("no trend source given")
+	case 1:
+		return sources[0].Source, nil
+	default:
+		return &AggregateTrendSource{Sources: sources}, nil
+	}
+}
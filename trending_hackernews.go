@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+const hackerNewsSearchUrl = "https://hn.algolia.com/api/v1/search"
+
+// hackerNewsDomains are the sites searched for stories linking to papers.
+var hackerNewsDomains = []string{"arxiv.org", "aclweb.org", "aclanthology.info", "openreview.net"}
+
+// HackerNewsTrendSource finds Hacker News stories linking to papers through
+// the Algolia search API, ranking them by points and comments.
+type HackerNewsTrendSource struct {
+	// Window is how far back stories are searched.
+	Window time.Duration
+	// Url defaults to the public Algolia search API.
+	Url string
+}
+
+func (s *HackerNewsTrendSource) Name() string {
+	return "hackernews"
+}
+
+func (s *HackerNewsTrendSource) Trending() ([]TrendingPaper, error) {
+	rawurl := s.Url
+	if rawurl == "" {
+		rawurl = hackerNewsSearchUrl
+	}
+	since := time.Now().Add(-s.Window).Unix()
+
+	var papers []TrendingPaper
+	// a domain failing leaves the stories linking to the others
+	var lastErr error
+	failed := 0
+	for _, domain := range hackerNewsDomains {
+		query := url.Values{}
+		query.Set("query", domain)
+		query.Set("restrictSearchableAttributes", "url")
+		query.Set("tags", "story")
+		query.Set("numericFilters", fmt.Sprintf("created_at_i>%d", since))
+		query.Set("hitsPerPage", "100")
+
+		var result struct {
+			Hits []struct {
+				ObjectId    string `json:"objectID"`
+				Url         string `json:"url"`
+				Points      int    `json:"points"`
+				NumComments int    `json:"num_comments"`
+			} `json:"hits"`
+		}
+		if err := getJSON(rawurl+"?"+query.Encode(), &result); err != nil {
+			trendLog.Error("Hacker News search error", "domain", domain, "error", err)
+			lastErr = err
+			failed++
+			continue
+		}
+
+		for _, hit := range result.Hits {
+			tp, ok := trendingPaperFromUrl(hit.Url)
+			if !ok {
+				continue
+			}
+			tp.Score = float64(hit.Points + hit.NumComments)
+			tp.Reason = fmt.Sprintf("%d points, %d comments on HN", hit.Points, hit.NumComments)
+			tp.DiscussionUrl = "https://news.ycombinator.com/item?id=" + hit.ObjectId
+			papers = append(papers, tp)
+		}
+	}
+	if failed == len(hackerNewsDomains) {
+		return nil, lastErr
+	}
+	papers = keepBestPerPaper(papers)
+	sortTrendingPapers(papers)
+	return papers, nil
+}
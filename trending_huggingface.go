@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const huggingFaceDailyPapersUrl = "https://huggingface.co/api/daily_papers"
+
+// huggingFaceCommentWeight is how many upvotes a comment on Hugging Face is
+// worth when scoring a paper.
+const huggingFaceCommentWeight = 3
+
+// HuggingFaceTrendSource reads the Hugging Face Daily Papers list, ranking
+// papers by their upvotes and comments.
+type HuggingFaceTrendSource struct {
+	// Url defaults to the public Daily Papers API.
+	Url string
+}
+
+func (s *HuggingFaceTrendSource) Name() string {
+	return "huggingface"
+}
+
+func (s *HuggingFaceTrendSource) Trending() ([]TrendingPaper, error) {
+	rawurl := s.Url
+	if rawurl == "" {
+		rawurl = huggingFaceDailyPapersUrl
+	}
+	var entries []struct {
+		Paper struct {
+			Id      string `json:"id"`
+			Upvotes int    `json:"upvotes"`
+		} `json:"paper"`
+		NumComments int `json:"numComments"`
+	}
+	if err := getJSON(rawurl, &entries); err != nil {
+		return nil, err
+	}
+
+	var papers []TrendingPaper
+	for _, e := range entries {
+		// Daily Papers are keyed by arXiv ID, occasionally with a version
+		id := arxivVersion.ReplaceAllString(strings.TrimSpace(e.Paper.Id), "")
+		if id == "" {
+			continue
+		}
+		papers = append(papers, TrendingPaper{
+			Id:     id,
+			Score:  float64(e.Paper.Upvotes + huggingFaceCommentWeight*e.NumComments),
+			Reason: fmt.Sprintf("%d upvotes, %d comments on HF", e.Paper.Upvotes, e.NumComments),
+		})
+	}
+	sortTrendingPapers(papers)
+	return papers, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"mvdan.cc/xurls"
+	"time"
+)
+
+// RedditTrendSource finds papers linked from the top posts of a subreddit,
+// ranking them by score and comments.
+type RedditTrendSource struct {
+	Subreddit string
+	// Window selects the top posts of the past day, week or month,
+	// whichever covers it.
+	Window time.Duration
+	// Url defaults to the subreddit's public JSON listing.
+	Url string
+}
+
+func (s *RedditTrendSource) Name() string {
+	return "reddit"
+}
+
+func (s *RedditTrendSource) Trending() ([]TrendingPaper, error) {
+	period := "month"
+	if s.Window <= 24*time.Hour {
+		period = "day"
+	} else if s.Window <= 7*24*time.Hour {
+		period = "week"
+	}
+	rawurl := s.Url
+	if rawurl == "" {
+		rawurl = fmt.Sprintf("https://www.reddit.com/r/%s/top.json", s.Subreddit)
+	}
+
+	var listing struct {
+		Data struct {
+			Children []struct {
+				Data struct {
+					Url         string `json:"url"`
+					Selftext    string `json:"selftext"`
+					Score       int    `json:"score"`
+					NumComments int    `json:"num_comments"`
+					Permalink   string `json:"permalink"`
+				} `json:"data"`
+			} `json:"children"`
+		} `json:"data"`
+	}
+	if err := getJSON(rawurl+"?limit=100&t="+period, &listing); err != nil {
+		return nil, err
+	}
+
+	var papers []TrendingPaper
+	for _, child := range listing.Data.Children {
+		post := child.Data
+		// papers are linked either as the post itself or from its text
+		urls := append([]string{post.Url}, xurls.Relaxed().FindAllString(post.Selftext, -1)...)
+		for _, u := range urls {
+			tp, ok := trendingPaperFromUrl(u)
+			if !ok {
+				continue
+			}
+			tp.Score = float64(post.Score + post.NumComments)
+			tp.Reason = fmt.Sprintf("%d points, %d comments on r/%s", post.Score, post.NumComments, s.Subreddit)
+			tp.DiscussionUrl = "https://www.reddit.com" + post.Permalink
+			papers = append(papers, tp)
+		}
+	}
+	papers = keepBestPerPaper(papers)
+	sortTrendingPapers(papers)
+	return papers, nil
+}
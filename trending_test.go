@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFeedTrendSource(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer server.Close()
+
+	source := &FeedTrendSource{Url: server.URL + "/trending_feed.json"}
+	papers, err := source.Trending()
+	assert.NoError(t, err)
+	assert.Equal(t, []TrendingPaper{
+		{Id: "1805.09547", Score: 120, Reason: "120 tweets"},
+		{Id: "1810.04805", Score: 87, Reason: "87 tweets"},
+		{Id: "1706.03762", Score: 87, Reason: "87 tweets"},
+	}, papers)
+
+	_, err = (&FeedTrendSource{Url: server.URL + "/missing.json"}).Trending()
+	assert.Error(t, err)
+}
+
+func TestHuggingFaceTrendSource(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer server.Close()
+
+	source := &HuggingFaceTrendSource{Url: server.URL + "/huggingface_daily_papers.json"}
+	papers, err := source.Trending()
+	assert.NoError(t, err)
+	assert.Equal(t, []TrendingPaper{
+		{Id: "2410.05258", Score: 162, Reason: "150 upvotes, 4 comments on HF"},
+		{Id: "2410.05229", Score: 51, Reason: "21 upvotes, 10 comments on HF"},
+		{Id: "2410.05254", Score: 3, Reason: "3 upvotes, 0 comments on HF"},
+	}, papers)
+}
+
+func TestHackerNewsTrendSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "url", r.URL.Query().Get("restrictSearchableAttributes"))
+		// a failing domain does not take the others down
+		if r.URL.Query().Get("query") == "openreview.net" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if r.URL.Query().Get("query") != "arxiv.org" {
+			w.Write([]byte(`{"hits": []}`))
+			return
+		}
+		http.ServeFile(w, r, "testdata/hackernews_search.json")
+	}))
+	defer server.Close()
+
+	source := &HackerNewsTrendSource{Window: 24 * time.Hour, Url: server.URL}
+	papers, err := source.Trending()
+	assert.NoError(t, err)
+	assert.Equal(t, []TrendingPaper{
+		{
+			Id:            "2410.05258",
+			Score:         710,
+			Reason:        "540 points, 170 comments on HN",
+			DiscussionUrl: "https://news.ycombinator.com/item?id=41776324",
+		},
+	}, papers)
+
+	// but all failing does
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	source.Url = failing.URL
+	_, err = source.Trending()
+	assert.Error(t, err)
+}
+
+func TestRedditTrendSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "week", r.URL.Query().Get("t"))
+		http.ServeFile(w, r, "testdata/reddit_top.json")
+	}))
+	defer server.Close()
+
+	source := &RedditTrendSource{Subreddit: "MachineLearning", Window: 7 * 24 * time.Hour, Url: server.URL}
+	papers, err := source.Trending()
+	assert.NoError(t, err)
+	assert.Equal(t, []TrendingPaper{
+		{
+			Id:            "2410.05229",
+			Score:         274,
+			Reason:        "210 points, 64 comments on r/MachineLearning",
+			DiscussionUrl: "https://www.reddit.com/r/MachineLearning/comments/1fz1abc/r_gsmsymbolic/",
+		},
+		{
+			Id:            "acl:P18-1200",
+			Score:         52,
+			Reason:        "40 points, 12 comments on r/MachineLearning",
+			Url:           "http://aclweb.org/anthology/P18-1200",
+			DiscussionUrl: "https://www.reddit.com/r/MachineLearning/comments/1fz2def/d_papers_from_acl/",
+		},
+	}, papers)
+}
+
+type fixedTrendSource struct {
+	name   string
+	papers []TrendingPaper
+	err    error
+}
+
+func (s *fixedTrendSource) Name() string {
+	return s.name
+}
+
+func (s *fixedTrendSource) Trending() ([]TrendingPaper, error) {
+	return s.papers, s.err
+}
+
+func TestAggregateTrendSource(t *testing.T) {
+	hf := &fixedTrendSource{name: "huggingface", papers: []TrendingPaper{
+		{Id: "2410.05258", Score: 200, Reason: "200 upvotes on HF"},
+		{Id: "2410.05229", Score: 100, Reason: "100 upvotes on HF"},
+	}}
+	hn := &fixedTrendSource{name: "hackernews", papers: []TrendingPaper{
+		{Id: "2410.05229v2", Score: 600, Reason: "600 points on HN", DiscussionUrl: "https://news.ycombinator.com/item?id=1"},
+		{Id: "acl:P18-1200", Url: "http://aclweb.org/anthology/P18-1200", Score: 300, Reason: "300 points on HN"},
+	}}
+	broken := &fixedTrendSource{name: "reddit", err: fmt.Errorf("unavailable")}
+
+	source := &AggregateTrendSource{Sources: []WeightedTrendSource{{hf, 1}, {hn, 0.5}, {broken, 1}}}
+	assert.Equal(t, "huggingface+hackernews+reddit", source.Name())
+	papers, err := source.Trending()
+	assert.NoError(t, err)
+	assert.Len(t, papers, 3)
+
+	assert.Equal(t, "2410.05258", papers[0].Id)
+	assert.Equal(t, 1.0, papers[0].Score)
+
+	assert.Equal(t, "2410.05229", papers[1].Id)
+	assert.Equal(t, 1.0, papers[1].Score)
+	assert.Equal(t, "100 upvotes on HF, 600 points on HN", papers[1].Reason)
+	assert.Equal(t, []TrendingPaper{hf.papers[1], hn.papers[0]}, papers[1].Evidence)
+
+	assert.Equal(t, "acl:P18-1200", papers[2].Id)
+	assert.Equal(t, "http://aclweb.org/anthology/P18-1200", papers[2].Url)
+	assert.Equal(t, 0.25, papers[2].Score)
+
+	_, err = (&AggregateTrendSource{Sources: []WeightedTrendSource{{broken, 1}}}).Trending()
+	assert.Error(t, err)
+}
+
+func TestParseTrendSources(t *testing.T) {
+	source, err := parseTrendSources("huggingface", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "huggingface", source.Name())
+
+	source, err = parseTrendSources("huggingface:1, hackernews:0.5", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "huggingface+hackernews", source.Name())
+	assert.Equal(t, 0.5, source.(*AggregateTrendSource).Sources[1].Weight)
+
+	_, err = parseTrendSources("huggingface:x", "")
+	assert.Error(t, err)
+	_, err = parseTrendSources("twitter", "")
+	assert.Error(t, err)
+	_, err = parseTrendSources("feed", "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// SubscriptionAuthor matches papers by an author, ignoring case.
+	SubscriptionAuthor = "author"
+	// SubscriptionKeyword matches papers with a keyword in the title or
+	// abstract.
+	SubscriptionKeyword = "keyword"
+)
+
+func isSubscriptionKind(kind string) bool {
+	return kind == SubscriptionAuthor || kind == SubscriptionKeyword
+}
+
+// userNotifiedRetention is how long a paper sent to a user is remembered, so
+// that a paper shared again or trending on several days is sent once.
+const userNotifiedRetention = 30 * 24 * time.Hour
+
+// UserSubscriptions holds the authors and keywords each user follows, and
+// the matching papers that are yet to be sent to them.
+type UserSubscriptions struct {
+	// Conversations tells which channels shared papers are passed on from.
+	// Without it no channel is taken to be public.
+	Conversations *Conversations
+
+	store *Store
+	mu    sync.Mutex
+	users map[string]*userSubscription
+}
+
+type userSubscription struct {
+	Authors  []string `json:",omitempty"`
+	Keywords []string `json:",omitempty"`
+	// Pending are the matches to be sent in the next digest.
+	Pending []UserMatch `json:",omitempty"`
+	// Notified holds the IDs of papers matched and when.
+	Notified map[string]time.Time `json:",omitempty"`
+}
+
+// UserMatch is a paper matching a user's subscriptions.
+type UserMatch struct {
+	Paper Paper
+	// Origin tells where the paper was seen, e.g. "new in cs.CL".
+	Origin string
+	// Reasons are the subscriptions matched, e.g. `author "Kentaro Inui"`.
+	Reasons []string
+}
+
+func NewUserSubscriptions(store *Store) (*UserSubscriptions, error) {
+	s := &UserSubscriptions{store: store, users: map[string]*userSubscription{}}
+	if err := store.Load("user_subscriptions", &s.users); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Subscriptions returns the authors and keywords user follows.
+func (s *UserSubscriptions) Subscriptions(user string) (authors, keywords []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[user]
+	if !ok {
+		return nil, nil
+	}
+	return u.Authors, u.Keywords
+}
+
+// Subscribe makes user follow value, an author or a keyword by kind.
+func (s *UserSubscriptions) Subscribe(user, kind, value string) error {
+	return s.update(user, func(u *userSubscription) {
+		values := u.values(kind)
+		for _, v := range *values {
+			if strings.EqualFold(v, value) {
+				return
+			}
+		}
+		*values = append(*values, value)
+	})
+}
+
+// Unsubscribe stops user following value.
+func (s *UserSubscriptions) Unsubscribe(user, kind, value string) error {
+	return s.update(user, func(u *userSubscription) {
+		values := u.values(kind)
+		var kept []string
+		for _, v := range *values {
+			if !strings.EqualFold(v, value) {
+				kept = append(kept, v)
+			}
+		}
+		*values = kept
+	})
+}
+
+func (s *UserSubscriptions) update(user string, f func(*userSubscription)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[user]
+	if !ok {
+		u = &userSubscription{}
+		s.users[user] = u
+	}
+	f(u)
+	return s.store.Save("user_subscriptions", s.users)
+}
+
+func (u *userSubscription) values(kind string) *[]string {
+	if kind == SubscriptionAuthor {
+		return &u.Authors
+	}
+	return &u.Keywords
+}
+
+// Match queues the papers seen at origin for the users they match, except
+// for the user who brought them up, if any. A paper is queued for a user
+// only once.
+func (s *UserSubscriptions) Match(origin string, papers []Paper, except string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	changed := false
+	for user, u := range s.users {
+		if user == except {
+			continue
+		}
+		for _, p := range papers {
+			reasons := u.match(p)
+			if len(reasons) == 0 {
+				continue
+			}
+			id := paperKey(p)
+			if _, ok := u.Notified[id]; ok {
+				continue
+			}
+			if u.Notified == nil {
+				u.Notified = map[string]time.Time{}
+			}
+			u.Notified[id] = now
+			// the abstract is not shown and would bloat the store
+			p.AbstText = ""
+			u.Pending = append(u.Pending, UserMatch{Paper: p, Origin: origin, Reasons: reasons})
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+	if err := s.store.Save("user_subscriptions", s.users); err != nil {
+		storeLog.Error("store error", "error", err)
+	}
+}
+
+// MatchShared queues the papers user shared in channel for the others they
+// match. Only public channels count: what is said in direct messages and
+// private channels is not passed on.
+func (s *UserSubscriptions) MatchShared(channel string, papers []Paper, user string) {
+	if s.Conversations == nil || s.Conversations.IsPrivate(channel) {
+		return
+	}
+	s.Match(fmt.Sprintf("shared in <#%s>", channel), papers, user)
+}
+
+func (u *userSubscription) match(p Paper) []string {
+	var reasons []string
+	for _, a := range u.Authors {
+		for _, author := range p.Authors {
+			if sameAuthor(a, author) {
+				reasons = append(reasons, fmt.Sprintf("author %q", a))
+				break
+			}
+		}
+	}
+	text := strings.ToLower(p.Title + " " + p.AbstText)
+	for _, k := range u.Keywords {
+		if containsAny(text, []string{k}) {
+			reasons = append(reasons, fmt.Sprintf("keyword %q", k))
+		}
+	}
+	return reasons
+}
+
+// sameAuthor compares names ignoring case and spacing.
+func sameAuthor(a, b string) bool {
+	return strings.EqualFold(strings.Join(strings.Fields(a), " "), strings.Join(strings.Fields(b), " "))
+}
+
+// paperKey identifies a paper across the URLs it is known by.
+func paperKey(p Paper) string {
+	if id, err := CanonicalId(p.AbstUrl); err == nil {
+		return id
+	}
+	return p.AbstUrl
+}
+
+// Flush hands the pending matches of each user to send as one digest and
+// forgets papers matched long ago. Matches that fail to be sent are kept
+// for the next flush.
+func (s *UserSubscriptions) Flush(send func(user, text string) error) {
+	// the digests are sent without the lock held, so that matching goes on
+	// while Slack is slow
+	s.mu.Lock()
+	pending := map[string][]UserMatch{}
+	for user, u := range s.users {
+		if len(u.Pending) > 0 {
+			pending[user] = u.Pending
+			u.Pending = nil
+		}
+	}
+	s.mu.Unlock()
+
+	users := make([]string, 0, len(pending))
+	for user := range pending {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+	failed := map[string][]UserMatch{}
+	for _, user := range users {
+		if err := send(user, formatUserDigest(pending[user])); err != nil {
+			notifyLog.Error("notification error", "user", user, "error", err)
+			failed[user] = pending[user]
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for user, u := range s.users {
+		// the matches queued while sending come after those that failed
+		if matches, ok := failed[user]; ok {
+			u.Pending = append(matches, u.Pending...)
+		}
+		for id, t := range u.Notified {
+			if now.Sub(t) > userNotifiedRetention {
+				delete(u.Notified, id)
+			}
+		}
+	}
+	if err := s.store.Save("user_subscriptions", s.users); err != nil {
+		storeLog.Error("store error", "error", err)
+	}
+}
+
+// formatUserDigest lists the papers matching a user's subscriptions in one
+// message.
+func formatUserDigest(matches []UserMatch) string {
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "*Papers matching your subscriptions* (%s)", countPapers(len(matches)))
+	for i, m := range matches {
+		_, _ = fmt.Fprintf(&b, "\n%d. [%s; %s] %s", i+1, strings.Join(m.Reasons, ", "), m.Origin, formatAsPlainPaperInfo(m.Paper))
+	}
+	return b.String()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"github.com/nlopes/slack"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestUserSubscriptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "paperbot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store, err := NewStore(dir)
+	assert.NoError(t, err)
+	subs, err := NewUserSubscriptions(store)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "OK", subscribeCommand(subs, "subscribe", splitArgs(`author "Kentaro Inui"`), "U1"))
+	assert.Equal(t, "OK", subscribeCommand(subs, "subscribe", splitArgs(`keyword “knowledge graph”`), "U1"))
+	assert.Equal(t, "OK", subscribeCommand(subs, "subscribe", splitArgs(`keyword parsing`), "U2"))
+	assert.Equal(t, subscribeUsage, subscribeCommand(subs, "subscribe", splitArgs(`venue ACL`), "U1"))
+	assert.Equal(t, `Your subscriptions: authors: "Kentaro Inui"; keywords: "knowledge graph"`, subscribeCommand(subs, "subscribe", nil, "U1"))
+
+	papers := []Paper{
+		{Title: "Knowledge Graph Embeddings", Authors: []string{"kentaro  inui"}, AbstUrl: "https://arxiv.org/abs/1805.09547"},
+		{Title: "Dependency Parsing", Authors: []string{"Someone"}, AbstUrl: "https://arxiv.org/abs/1805.00001"},
+	}
+	subs.Match("new in cs.CL", papers, "")
+	// the same paper under another version is not queued again
+	papers[0].AbstUrl = "https://arxiv.org/abs/1805.09547v2"
+	subs.Match("trending", papers[:1], "")
+	subs.Conversations = NewConversations(func(channel string) (*slack.Channel, error) {
+		ch := &slack.Channel{}
+		ch.IsPrivate = channel == "C2"
+		return ch, nil
+	})
+	// the user sharing a paper is not notified of it
+	subs.MatchShared("C1", []Paper{{Title: "Parsing again", AbstUrl: "https://arxiv.org/abs/1805.00002"}}, "U2")
+	// nor is anyone of papers shared in direct messages or private channels
+	subs.MatchShared("D1", []Paper{{Title: "Parsing in private", AbstUrl: "https://arxiv.org/abs/1805.00003"}}, "U1")
+	subs.MatchShared("G1", []Paper{{Title: "Parsing in a group", AbstUrl: "https://arxiv.org/abs/1805.00004"}}, "U1")
+	subs.MatchShared("C2", []Paper{{Title: "Parsing in a private channel", AbstUrl: "https://arxiv.org/abs/1805.00005"}}, "U1")
+
+	// the pending matches survive a restart
+	subs, err = NewUserSubscriptions(store)
+	assert.NoError(t, err)
+
+	sent := map[string]string{}
+	subs.Flush(func(user, text string) error {
+		if user == "U2" {
+			return errors.New("not reachable")
+		}
+		sent[user] = text
+		return nil
+	})
+	assert.Equal(t, map[string]string{
+		"U1": "*Papers matching your subscriptions* (1 paper)\n" +
+			`1. [author "Kentaro Inui", keyword "knowledge graph"; new in cs.CL] kentaro  inui. <https://arxiv.org/abs/1805.09547 |Knowledge Graph Embeddings>. 0`,
+	}, sent)
+
+	// U2's digest is kept until it is sent
+	sent = map[string]string{}
+	subs.Flush(func(user, text string) error {
+		sent[user] = text
+		return nil
+	})
+	assert.Contains(t, sent["U2"], "Dependency Parsing")
+	assert.NotContains(t, sent["U2"], "in private")
+	assert.NotContains(t, sent["U2"], "in a group")
+	assert.NotContains(t, sent["U2"], "in a private channel")
+	assert.NotContains(t, sent, "U1")
+
+	assert.Equal(t, "OK", subscribeCommand(subs, "unsubscribe", splitArgs(`author "kentaro inui"`), "U1"))
+	authors, keywords := subs.Subscriptions("U1")
+	assert.Empty(t, authors)
+	assert.Equal(t, []string{"knowledge graph"}, keywords)
+}
+
+func TestConversations(t *testing.T) {
+	var asked []string
+	conversations := NewConversations(func(channel string) (*slack.Channel, error) {
+		asked = append(asked, channel)
+		if channel == "C3" {
+			return nil, errors.New("channel_not_found")
+		}
+		ch := &slack.Channel{}
+		ch.IsPrivate = channel == "C2"
+		return ch, nil
+	})
+	for i := 0; i < 2; i++ {
+		assert.False(t, conversations.IsPrivate("C1"))
+		assert.True(t, conversations.IsPrivate("C2"))
+		assert.True(t, conversations.IsPrivate("C3"))
+		assert.True(t, conversations.IsPrivate("D1"))
+		assert.True(t, conversations.IsPrivate("G1"))
+	}
+	// the answers are remembered, but not the failures
+	assert.Equal(t, []string{"C1", "C2", "C3", "C3"}, asked)
+}